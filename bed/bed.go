@@ -0,0 +1,163 @@
+// Copyright ©2015 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package bed provides BED12 output of chained repeat annotations for
+// display in genome browsers.
+package bed
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/biogo/biogo/seq"
+)
+
+// Block is a zero-based half-open genomic interval of a BED12 record.
+type Block struct {
+	Start, End int
+}
+
+// Record is a chained repeat annotation to be written as BED12.
+type Record struct {
+	Chrom string
+
+	// Name is the BED name of the record. By
+	// convention this is class/name.
+	Name string
+
+	// Class is the repeat class of the
+	// record and is used to select the
+	// item RGB value.
+	Class string
+
+	Score  float64
+	Strand seq.Strand
+
+	// Blocks are the genomic intervals of
+	// the parts of the record.
+	Blocks []Block
+}
+
+// Writer writes BED12 records.
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter returns a new BED12 Writer that writes to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Write writes r to the underlying writer. The blocks of r are sorted and
+// overlapping blocks are merged. The thick region of the record is set to
+// the span of the blocks and the score is clamped to the BED score range.
+func (w *Writer) Write(r Record) error {
+	if len(r.Blocks) == 0 {
+		return fmt.Errorf("bed: no blocks in %s", r.Name)
+	}
+	blocks := merge(r.Blocks)
+	start := blocks[0].Start
+	end := blocks[len(blocks)-1].End
+
+	var sizes, starts bytes.Buffer
+	for i, b := range blocks {
+		if i != 0 {
+			sizes.WriteByte(',')
+			starts.WriteByte(',')
+		}
+		fmt.Fprint(&sizes, b.End-b.Start)
+		fmt.Fprint(&starts, b.Start-start)
+	}
+
+	_, err := fmt.Fprintf(w.w, "%s\t%d\t%d\t%s\t%d\t%s\t%d\t%d\t%s\t%d\t%s\t%s\n",
+		r.Chrom, start, end,
+		strings.Replace(r.Name, " ", "_", -1), score(r.Score), strand(r.Strand),
+		start, end,
+		Color(r.Class),
+		len(blocks), sizes.String(), starts.String(),
+	)
+	return err
+}
+
+// merge returns a sorted copy of b with overlapping blocks merged.
+func merge(b []Block) []Block {
+	s := make([]Block, len(b))
+	copy(s, b)
+	sort.Sort(byStart(s))
+	m := s[:1]
+	for _, e := range s[1:] {
+		last := &m[len(m)-1]
+		if e.Start <= last.End {
+			if e.End > last.End {
+				last.End = e.End
+			}
+			continue
+		}
+		m = append(m, e)
+	}
+	return m
+}
+
+type byStart []Block
+
+func (b byStart) Len() int           { return len(b) }
+func (b byStart) Less(i, j int) bool { return b[i].Start < b[j].Start }
+func (b byStart) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
+func score(s float64) int {
+	switch {
+	case math.IsNaN(s), s < 0:
+		return 0
+	case s > 1000:
+		return 1000
+	default:
+		return int(s)
+	}
+}
+
+func strand(s seq.Strand) string {
+	switch s {
+	case seq.Plus:
+		return "+"
+	case seq.Minus:
+		return "-"
+	default:
+		return "."
+	}
+}
+
+// colors is the item RGB palette for major repeat classes.
+var colors = map[string]string{
+	"SINE":           "31,119,180",
+	"LINE":           "214,39,40",
+	"LTR":            "44,160,44",
+	"DNA":            "148,103,189",
+	"RC":             "140,86,75",
+	"Satellite":      "227,119,194",
+	"Simple_repeat":  "127,127,127",
+	"Low_complexity": "188,189,34",
+	"rRNA":           "23,190,207",
+	"tRNA":           "23,190,207",
+	"snRNA":          "23,190,207",
+	"scRNA":          "23,190,207",
+	"srpRNA":         "23,190,207",
+}
+
+// Color returns the item RGB value used for the given repeat class. Only
+// the major class, the part of class before any '/', is considered.
+// Unknown classes are black.
+func Color(class string) string {
+	if i := strings.Index(class, "/"); i >= 0 {
+		class = class[:i]
+	}
+	c, ok := colors[strings.TrimSuffix(class, "?")]
+	if !ok {
+		return "0,0,0"
+	}
+	return c
+}
@@ -0,0 +1,299 @@
+// Copyright ©2015 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package chain provides the repeat feature types and the cost model used
+// to chain repeat annotation features into composites.
+package chain
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/biogo/biogo/feat"
+	"github.com/biogo/biogo/io/featio/gff"
+	"github.com/biogo/biogo/seq"
+)
+
+// None indicates an unavailable consensus position or divergence.
+const None = -1
+
+// Location is a repeat-matching interval.
+type Location struct {
+	Chrom  string
+	Left   int
+	Right  int
+	Strand seq.Strand
+}
+
+// Overlaps returns whether l overlaps r.
+func (l Location) Overlaps(r Location) bool {
+	return l.Chrom == r.Chrom && l.Left < r.Right && r.Left < l.Right
+}
+
+// Simple is a masked repeat record.
+type Simple struct {
+	// Genomic is the genomic region matched
+	// to the the repeat identified below.
+	Genomic Location
+
+	// Name and Class are the repeat type
+	// and class defined by the masker.
+	Name, Class string
+
+	// ID is the source record ID of the
+	// repeat if it is available.
+	ID string
+
+	// Div is the percent divergence of the
+	// repeat from its consensus, or None if
+	// it is not available.
+	Div float64
+
+	// OtherMatch indicates that the masker
+	// identified a higher scoring match
+	// overlapping the repeat.
+	OtherMatch bool
+
+	// Score is the feature score.
+	Score float64
+
+	// Left and Right are the left and right
+	// position of the simple alignment in
+	// consensus-relative coordinates.
+	Left, Right int
+}
+
+// NewSimple returns the simple repeat described by the GFF feature f,
+// which must have a Repeat attribute. The RMID, Div and OtherMatch
+// attributes are used if present.
+func NewSimple(f *gff.Feature) (*Simple, error) {
+	repeat := &Simple{
+		Genomic: Location{
+			Left:   f.FeatStart,
+			Right:  f.FeatEnd,
+			Chrom:  f.SeqName,
+			Strand: f.FeatStrand,
+		},
+	}
+	if f.FeatScore != nil {
+		repeat.Score = *f.FeatScore
+	}
+	repeat.ID = f.FeatAttributes.Get("RMID")
+	repeat.OtherMatch = f.FeatAttributes.Get("OtherMatch") != ""
+	repeat.Div = None
+	if div := f.FeatAttributes.Get("Div"); div != "" {
+		var err error
+		repeat.Div, err = strconv.ParseFloat(div, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse divergence: %v", err)
+		}
+	}
+
+	ra := f.FeatAttributes.Get("Repeat")
+	if ra == "" {
+		return nil, fmt.Errorf("missing repeat tag: file probably not an RM gff.")
+	}
+	err := repeat.parse(ra)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse repeat tag: %v\n", err)
+	}
+	return repeat, nil
+}
+
+func (r *Simple) parse(a string) error {
+	fields := strings.Split(a, " ")
+	if len(fields) < 4 {
+		return fmt.Errorf("invalid repeat tag: %q", a)
+	}
+
+	r.Name = fields[0]
+	r.Class = fields[1]
+	var err error
+	if fields[2] != "." {
+		r.Left, err = strconv.Atoi(fields[2])
+		if err != nil {
+			return err
+		}
+		r.Left = feat.OneToZero(r.Left)
+	} else {
+		r.Left = None
+	}
+	if fields[3] != "." {
+		r.Right, err = strconv.Atoi(fields[3])
+		if err != nil {
+			return err
+		}
+	} else {
+		r.Right = None
+	}
+
+	return nil
+}
+
+// Part is a simple repeat that is part of a composite.
+type Part struct {
+	Name        string
+	ID          string
+	Div         float64
+	Left, Right int
+	Genomic     Location
+}
+
+// NewPart returns a Part holding the details of r.
+func NewPart(r *Simple) Part {
+	return Part{
+		Name:    r.Name,
+		ID:      r.ID,
+		Div:     r.Div,
+		Left:    r.Left,
+		Right:   r.Right,
+		Genomic: r.Genomic,
+	}
+}
+
+// Simple returns a Simple with the location and consensus
+// coordinates of p.
+func (p Part) Simple() *Simple {
+	return &Simple{Genomic: p.Genomic, Name: p.Name, ID: p.ID, Div: p.Div, Left: p.Left, Right: p.Right}
+}
+
+// Parts is the set of parts of a composite.
+type Parts []Part
+
+// ParseParts returns the parts described by the quoted value of a Parts
+// attribute of a composite on the given chromosome and strand. The divergence
+// of the returned parts is None, as are consensus positions written from None.
+func ParseParts(attr, chrom string, strand seq.Strand) (Parts, error) {
+	a, err := strconv.Unquote(attr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unquote parts: %v", err)
+	}
+	var p Parts
+	for _, s := range strings.Split(a, "|") {
+		fields := strings.Fields(s)
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("unexpected number of fields in part %q", s)
+		}
+		var c [4]int
+		for i, f := range fields[1:] {
+			c[i], err = strconv.Atoi(f)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse part coordinate: %v", err)
+			}
+		}
+		if c[2] < 1 {
+			return nil, fmt.Errorf("invalid part genomic start in %q", s)
+		}
+		left := None
+		if c[0] > 0 {
+			left = feat.OneToZero(c[0])
+		}
+		p = append(p, Part{
+			Name:  fields[0],
+			Div:   None,
+			Left:  left,
+			Right: c[1],
+			Genomic: Location{
+				Chrom:  chrom,
+				Left:   feat.OneToZero(c[2]),
+				Right:  c[3],
+				Strand: strand,
+			},
+		})
+	}
+	return p, nil
+}
+
+// String returns the quoted value of the Parts attribute describing p.
+func (p Parts) String() string {
+	var buf bytes.Buffer
+	for i, e := range p {
+		if i == 0 {
+			buf.WriteByte('"')
+		} else {
+			buf.WriteByte('|')
+		}
+		fmt.Fprintf(&buf, `%s %d %d %d %d`,
+			e.Name,
+			feat.ZeroToOne(e.Left), e.Right,
+			feat.ZeroToOne(e.Genomic.Left), e.Genomic.Right,
+		)
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// IDs returns the quoted source record IDs of the parts in p and
+// whether any part has a source ID. Parts without an ID are
+// represented by ".".
+func (p Parts) IDs() (string, bool) {
+	var (
+		buf bytes.Buffer
+		ok  bool
+	)
+	buf.WriteByte('"')
+	for i, e := range p {
+		if i != 0 {
+			buf.WriteByte('|')
+		}
+		if e.ID == "" {
+			buf.WriteByte('.')
+			continue
+		}
+		ok = true
+		buf.WriteString(e.ID)
+	}
+	buf.WriteByte('"')
+	return buf.String(), ok
+}
+
+// Composite is a chain of repeat parts.
+type Composite struct {
+	Class string
+	Score float64
+	Parts Parts
+}
+
+// End returns the right-most genomic position of the parts of c.
+func (c Composite) End() int {
+	right := c.Parts[0].Genomic.Right
+	for _, p := range c.Parts[1:] {
+		if p.Genomic.Right > right {
+			right = p.Genomic.Right
+		}
+	}
+	return right
+}
+
+// Divergence returns the mean divergence of the parts of c weighted by
+// their genomic length. Parts without a divergence are not included. If
+// no part with a divergence has a genomic length, ok is false.
+func (c Composite) Divergence() (div float64, ok bool) {
+	var length float64
+	for _, p := range c.Parts {
+		if p.Div == None {
+			continue
+		}
+		n := float64(p.Genomic.Right - p.Genomic.Left)
+		div += p.Div * n
+		length += n
+	}
+	if length == 0 {
+		return 0, false
+	}
+	return div / length, true
+}
+
+// ByRightEnd sorts simple repeats by chromosome and then by right end.
+type ByRightEnd []*Simple
+
+func (r ByRightEnd) Len() int { return len(r) }
+func (r ByRightEnd) Less(i, j int) bool {
+	iName := r[i].Genomic.Chrom
+	jName := r[j].Genomic.Chrom
+	return iName < jName || (iName == jName && r[i].Genomic.Right < r[j].Genomic.Right)
+}
+func (r ByRightEnd) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
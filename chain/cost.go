@@ -1,4 +1,8 @@
-package main
+// Copyright ©2015 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chain
 
 import (
 	"math"
@@ -6,8 +10,8 @@ import (
 	"github.com/biogo/biogo/seq"
 )
 
-// maxSpan is the maximum distance we will examine left of our current right element.
-const maxSpan = 1e5
+// MaxSpan is the maximum distance we will examine left of our current right element.
+const MaxSpan = 1e5
 
 // Tolerance values specify the width of troughs in the cost function.
 // Values for tolerance are greater than or equal to zero.
@@ -17,20 +21,22 @@ const (
 	concordTolerance  = 0.5
 )
 
-func costFunction(left, right *simple) (score float64, ok bool) {
+// Cost returns the score of left less the cost of linking left to right.
+// If the link cannot be made, ok is false.
+func Cost(left, right *Simple) (score float64, ok bool) {
 	// Short circuit if we got here without a strand or
 	// if the distance between the sorted ends is greater
 	// than our maximum span.
-	if right.genomic.strand == seq.None || right.genomic.right-left.genomic.right > maxSpan {
+	if right.Genomic.Strand == seq.None || right.Genomic.Right-left.Genomic.Right > MaxSpan {
 		return math.Inf(-1), false
 	}
 
-	gOverlap := left.genomic.right - right.genomic.left
+	gOverlap := left.Genomic.Right - right.Genomic.Left
 	var rOverlap int
-	if right.genomic.strand == seq.Plus {
-		rOverlap = left.right - right.left
+	if right.Genomic.Strand == seq.Plus {
+		rOverlap = left.Right - right.Left
 	} else {
-		rOverlap = right.right - left.left
+		rOverlap = right.Right - left.Left
 	}
 
 	cost := math.Pow(float64(abs(gOverlap)), gOverlapTolerance) *
@@ -64,7 +70,7 @@ func costFunction(left, right *simple) (score float64, ok bool) {
 		cost *= 10
 	}
 
-	return left.score - math.Abs(cost), true
+	return left.Score - math.Abs(cost), true
 }
 
 func abs(a int) int {
@@ -0,0 +1,250 @@
+// Copyright ©2015 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// coverage summarises the genome coverage of repeat annotation at each stage
+// of a quilt run.
+//
+// The outputs of the pipeline stages are each given by a flag: -converted for
+// rm2gff or map2gff output, -stitch for stitch output, -tailor for tailor
+// output and -patch for patchwork output. Features with a Repeat attribute are
+// counted as simple repeats, classed and named by their Repeat attribute, and
+// features with a Parts attribute are counted as composites, classed by their
+// Class attribute and named by the name of their first part. Composites cover
+// only the genomic intervals of their parts. Other features are ignored.
+//
+// For each stage, the number of elements and the number of non-redundant bases
+// covered, after merging overlapping intervals on each chromosome, are written
+// as TSV for each class, for each family, and for all repeats with the label
+// "all". The change in the number of elements relative to the converted stage
+// is given when the converted annotation is provided. If the genome length is
+// known from the -lengths file of tab separated sequence names and lengths, or
+// from the -genome fasta file, the fraction of the genome covered is also
+// given; otherwise the fraction is written as ".".
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/biogo/biogo/io/featio/gff"
+
+	"github.com/kortschak/quilt/chain"
+	"github.com/kortschak/quilt/genome"
+)
+
+var (
+	converted   = flag.String("converted", "", "Filename for converted repeat annotation.")
+	stitched    = flag.String("stitch", "", "Filename for stitch output.")
+	tailored    = flag.String("tailor", "", "Filename for tailor output.")
+	patched     = flag.String("patch", "", "Filename for patchwork output.")
+	lengthsFile = flag.String("lengths", "", "Filename for tab separated sequence lengths.")
+	genomeFile  = flag.String("genome", "", "Filename for genome fasta.")
+	help        = flag.Bool("help", false, "Print this usage message.")
+)
+
+func main() {
+	flag.Parse()
+	if *help || (*converted == "" && *stitched == "" && *tailored == "" && *patched == "") {
+		flag.Usage()
+		os.Exit(0)
+	}
+
+	length, err := genome.Length(*lengthsFile, *genomeFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var stages []*stage
+	for _, s := range []struct{ name, file string }{
+		{name: "converted", file: *converted},
+		{name: "stitch", file: *stitched},
+		{name: "tailor", file: *tailored},
+		{name: "patchwork", file: *patched},
+	} {
+		if s.file == "" {
+			continue
+		}
+		st, err := readStage(s.name, s.file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		stages = append(stages, st)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	err = write(w, stages, length)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		log.Fatalf("failed to write coverage: %v", err)
+	}
+}
+
+// tally is the annotation of a label in a stage.
+type tally struct {
+	elements  int
+	intervals genome.Intervals
+}
+
+// stage holds the annotation of a pipeline stage by class, by family
+// and for all repeats.
+type stage struct {
+	name   string
+	all    *tally
+	class  map[string]*tally
+	family map[string]*tally
+}
+
+// add adds an element covering the given intervals on chrom to s.
+func (s *stage) add(chrom string, iv [][2]int, class, family string) {
+	for _, t := range []*tally{s.all, get(s.class, class), get(s.family, family)} {
+		t.elements++
+		t.intervals[chrom] = append(t.intervals[chrom], iv...)
+	}
+}
+
+func get(m map[string]*tally, label string) *tally {
+	t, ok := m[label]
+	if !ok {
+		t = &tally{intervals: make(genome.Intervals)}
+		m[label] = t
+	}
+	return t
+}
+
+// readStage returns the annotation in the named GFF file.
+func readStage(name, file string) (*stage, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %q: %v", file, err)
+	}
+	defer f.Close()
+	fmt.Fprintf(os.Stderr, "reading repeat features from %q\n", file)
+
+	s := &stage{
+		name:   name,
+		all:    &tally{intervals: make(genome.Intervals)},
+		class:  make(map[string]*tally),
+		family: make(map[string]*tally),
+	}
+	in := gff.NewReader(f)
+	for {
+		f, err := in.Read()
+		if err != nil {
+			if err != io.EOF {
+				return nil, fmt.Errorf("failed to read feature from %q: %v", file, err)
+			}
+			return s, nil
+		}
+		gf := f.(*gff.Feature)
+		switch {
+		case gf.FeatAttributes.Get("Parts") != "":
+			class, err := strconv.Unquote(gf.FeatAttributes.Get("Class"))
+			if err != nil {
+				return nil, fmt.Errorf("failed to unquote class: %v", err)
+			}
+			parts, err := chain.ParseParts(gf.FeatAttributes.Get("Parts"), gf.SeqName, gf.FeatStrand)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %v", err, gf)
+			}
+			iv := make([][2]int, len(parts))
+			for i, p := range parts {
+				iv[i] = [2]int{p.Genomic.Left, p.Genomic.Right}
+			}
+			s.add(gf.SeqName, iv, class, parts[0].Name)
+		case gf.FeatAttributes.Get("Repeat") != "":
+			fields := strings.Fields(gf.FeatAttributes.Get("Repeat"))
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("bad repeat attribute: %v", gf)
+			}
+			s.add(gf.SeqName, [][2]int{{gf.FeatStart, gf.FeatEnd}}, fields[1], fields[0])
+		}
+	}
+}
+
+// write writes the coverage of each stage to w. Element count changes are
+// relative to the converted stage if it is present, and genome fractions are
+// given if genome is not zero.
+func write(w io.Writer, stages []*stage, genome int) error {
+	var base *stage
+	if len(stages) != 0 && stages[0].name == "converted" {
+		base = stages[0]
+	}
+	_, err := fmt.Fprintln(w, "stage\tlevel\tlabel\telements\telement_change\tbases\tfraction")
+	if err != nil {
+		return err
+	}
+	for _, s := range stages {
+		for _, l := range []struct {
+			level  string
+			tally  map[string]*tally
+			origin map[string]*tally
+		}{
+			{level: "all", tally: map[string]*tally{"all": s.all}, origin: baseAll(base)},
+			{level: "class", tally: s.class, origin: baseLevel(base, "class")},
+			{level: "family", tally: s.family, origin: baseLevel(base, "family")},
+		} {
+			labels := make([]string, 0, len(l.tally))
+			for k := range l.tally {
+				labels = append(labels, k)
+			}
+			for k := range l.origin {
+				if _, ok := l.tally[k]; !ok {
+					labels = append(labels, k)
+				}
+			}
+			sort.Strings(labels)
+			for _, label := range labels {
+				t, ok := l.tally[label]
+				if !ok {
+					t = &tally{}
+				}
+				change := "."
+				if l.origin != nil {
+					var n int
+					if o, ok := l.origin[label]; ok {
+						n = o.elements
+					}
+					change = fmt.Sprintf("%+d", t.elements-n)
+				}
+				bases := t.intervals.Bases()
+				fraction := "."
+				if genome != 0 {
+					fraction = fmt.Sprintf("%.4g", float64(bases)/float64(genome))
+				}
+				_, err = fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%d\t%s\n",
+					s.name, l.level, label, t.elements, change, bases, fraction)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func baseAll(base *stage) map[string]*tally {
+	if base == nil {
+		return nil
+	}
+	return map[string]*tally{"all": base.all}
+}
+
+func baseLevel(base *stage, level string) map[string]*tally {
+	if base == nil {
+		return nil
+	}
+	if level == "class" {
+		return base.class
+	}
+	return base.family
+}
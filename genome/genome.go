@@ -0,0 +1,139 @@
+// Copyright ©2015 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package genome provides genome lengths and the genomic coverage of sets of
+// intervals for summarising repeat annotation.
+package genome
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/biogo/biogo/alphabet"
+	"github.com/biogo/biogo/io/seqio"
+	"github.com/biogo/biogo/io/seqio/fasta"
+	"github.com/biogo/biogo/seq/linear"
+)
+
+// Length returns the total length of the genome described by the named file
+// of tab separated sequence names and lengths or, if lengthsFile is empty, by
+// the named fasta file. If both are empty, the returned length is zero.
+func Length(lengthsFile, fastaFile string) (int, error) {
+	switch {
+	case lengthsFile != "":
+		lengths, err := ReadLengths(lengthsFile)
+		if err != nil {
+			return 0, err
+		}
+		var total int
+		for _, n := range lengths {
+			total += n
+		}
+		return total, nil
+	case fastaFile != "":
+		return FastaLength(fastaFile)
+	}
+	return 0, nil
+}
+
+// ReadLengths returns the length of each sequence in the named file of tab
+// separated sequence names and lengths. Blank lines and lines starting with
+// '#' are ignored.
+func ReadLengths(file string) (map[string]int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %q: %v", file, err)
+	}
+	defer f.Close()
+
+	lengths := make(map[string]int)
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		b := bytes.TrimSpace(sc.Bytes())
+		if len(b) == 0 || b[0] == '#' {
+			continue
+		}
+		fields := strings.Split(string(b), "\t")
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("too few fields on line %d of %q", line, file)
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse length on line %d of %q: %v", line, file, err)
+		}
+		lengths[fields[0]] = n
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return lengths, nil
+}
+
+// FastaLength returns the total length of the sequences in the named
+// fasta file.
+func FastaLength(file string) (int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, fmt.Errorf("could not open %q: %v", file, err)
+	}
+	defer f.Close()
+
+	var total int
+	sc := seqio.NewScanner(fasta.NewReader(f, linear.NewSeq("", nil, alphabet.DNA)))
+	for sc.Next() {
+		total += sc.Seq().Len()
+	}
+	if sc.Error() != nil {
+		return 0, fmt.Errorf("failed during genome read: %v", sc.Error())
+	}
+	return total, nil
+}
+
+// Intervals holds zero-based half-open intervals on each chromosome.
+type Intervals map[string][][2]int
+
+// Add adds the interval [start, end) on chrom to iv.
+func (iv Intervals) Add(chrom string, start, end int) {
+	iv[chrom] = append(iv[chrom], [2]int{start, end})
+}
+
+// Bases returns the number of bases covered by at least one interval in iv.
+func (iv Intervals) Bases() int {
+	var n int
+	for _, c := range iv {
+		n += Bases(c)
+	}
+	return n
+}
+
+// Bases returns the number of bases covered by at least one of the
+// intervals in iv, after merging overlapping intervals. The intervals
+// are sorted by start in place.
+func Bases(iv [][2]int) int {
+	sort.Sort(byStart(iv))
+	var n, end int
+	for i, e := range iv {
+		if i == 0 || e[0] > end {
+			n += e[1] - e[0]
+			end = e[1]
+			continue
+		}
+		if e[1] > end {
+			n += e[1] - end
+			end = e[1]
+		}
+	}
+	return n
+}
+
+type byStart [][2]int
+
+func (s byStart) Len() int           { return len(s) }
+func (s byStart) Less(i, j int) bool { return s[i][0] < s[j][0] }
+func (s byStart) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,31 @@
+// Copyright ©2015 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package gff3 provides helpers for writing GFF3 output of chained repeat
+// annotations.
+package gff3
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Escape returns s with the characters reserved by GFF3 percent-encoded.
+// If attr is true, the characters reserved in column 9 are also encoded.
+func Escape(s string, attr bool) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		switch {
+		case b < 0x20, b == 0x7f, b == '%', b == '\t':
+			fmt.Fprintf(&buf, "%%%02X", b)
+		case attr && strings.IndexByte(";=&,", b) >= 0:
+			fmt.Fprintf(&buf, "%%%02X", b)
+		default:
+			buf.WriteByte(b)
+		}
+	}
+	return buf.String()
+}
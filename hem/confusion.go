@@ -0,0 +1,141 @@
+// Copyright ©2015 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/kortschak/quilt/chain"
+)
+
+// confusion records the co-occurrence of repeat names within
+// the composites of a class.
+type confusion struct {
+	// length is the total length of parts
+	// with each name and total is the total
+	// length of all parts. Parts without a
+	// consensus interval are not counted.
+	length map[string]int
+	total  int
+
+	// pairs is the number of times that a part
+	// with the first name is followed in a
+	// composite by a part with the second.
+	pairs map[[2]string]int
+}
+
+func newConfusion() *confusion {
+	return &confusion{
+		length: make(map[string]int),
+		pairs:  make(map[[2]string]int),
+	}
+}
+
+// add adds the parts of a composite to c.
+func (c *confusion) add(parts chain.Parts) {
+	for i, p := range parts {
+		if i != 0 {
+			c.pairs[[2]string{parts[i-1].Name, p.Name}]++
+		}
+		if p.Left == chain.None {
+			continue
+		}
+		n := p.Genomic.Right - p.Genomic.Left
+		c.length[p.Name] += n
+		c.total += n
+	}
+}
+
+// confusionStats is the confusion matrix for a class. Rows of the
+// matrix are the preceding part name and columns are the following
+// part name, both in the order of Names.
+type confusionStats struct {
+	Names  []nameStats `json:"names"`
+	Matrix [][]int     `json:"matrix"`
+}
+
+// nameStats is the contribution of a repeat name to the length of
+// the composites of a class.
+type nameStats struct {
+	Name     string  `json:"name"`
+	Length   int     `json:"length"`
+	Fraction float64 `json:"fraction"`
+}
+
+func (c *confusion) stats() *confusionStats {
+	names := make([]string, 0, len(c.length))
+	for n := range c.length {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	s := &confusionStats{Matrix: make([][]int, len(names))}
+	for i, from := range names {
+		ns := nameStats{Name: from, Length: c.length[from]}
+		if c.total != 0 {
+			ns.Fraction = float64(ns.Length) / float64(c.total)
+		}
+		s.Names = append(s.Names, ns)
+		s.Matrix[i] = make([]int, len(names))
+		for j, to := range names {
+			s.Matrix[i][j] = c.pairs[[2]string{from, to}]
+		}
+	}
+	return s
+}
+
+// writeTable writes the confusion matrix to w aligned for reading. The
+// final column holds the fraction of composite length contributed by each
+// name.
+func (s *confusionStats) writeTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', tabwriter.Debug)
+	fmt.Fprint(tw, "from\\to")
+	for _, n := range s.Names {
+		fmt.Fprintf(tw, "\t%s", n.Name)
+	}
+	fmt.Fprint(tw, "\tlength_frac\n")
+	for i, row := range s.Matrix {
+		fmt.Fprint(tw, s.Names[i].Name)
+		for _, v := range row {
+			fmt.Fprintf(tw, "\t%d", v)
+		}
+		_, err := fmt.Fprintf(tw, "\t%.4g\n", s.Names[i].Fraction)
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
+
+// writeConfusionTSV writes the confusion matrices of the classes in s to
+// w as tab separated values with one line for each pair of names in each
+// class. The final column holds the fraction of composite length of the
+// class contributed by the preceding name.
+func writeConfusionTSV(w io.Writer, s []stats) error {
+	_, err := fmt.Fprintln(w, "class\tfrom\tto\tcount\tfrom_length_frac")
+	if err != nil {
+		return err
+	}
+	for _, c := range s {
+		if c.Confusion == nil {
+			continue
+		}
+		for i, row := range c.Confusion.Matrix {
+			from := c.Confusion.Names[i]
+			for j, v := range row {
+				_, err = fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%.4g\n",
+					c.Class, from.Name, c.Confusion.Names[j].Name, v, from.Fraction,
+				)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
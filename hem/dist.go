@@ -0,0 +1,252 @@
+// Copyright ©2015 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/biogo/biogo/seq"
+
+	"github.com/kortschak/quilt/chain"
+)
+
+// measures are the names of the link distances recorded by distances,
+// matching the terms of the stitch cost function.
+var measures = [...]string{"gOverlap", "rOverlap", "gOverlap-rOverlap"}
+
+// quantiles are the quantiles reported for each distribution.
+var quantiles = []float64{0, 0.05, 0.25, 0.5, 0.75, 0.95, 1}
+
+// distances records the genomic and consensus overlaps between consecutive
+// parts of composites, by class.
+type distances struct {
+	// width is the width of histogram bins and
+	// limit is the absolute value beyond which
+	// distances are collected into the end bins.
+	width, limit int
+
+	byClass map[string]*[len(measures)][]int
+}
+
+func newDistances(width, limit int) *distances {
+	return &distances{width: width, limit: limit, byClass: make(map[string]*[len(measures)][]int)}
+}
+
+// add adds the links between the parts of a composite of the given class and
+// strand to d. Parts are linked in the order they are given. Composites without
+// a strand are ignored, and consensus overlaps are not recorded for links to
+// parts without a consensus interval.
+func (d *distances) add(class string, strand seq.Strand, parts chain.Parts) {
+	if strand == seq.None {
+		return
+	}
+	m, ok := d.byClass[class]
+	if !ok {
+		m = &[len(measures)][]int{}
+		d.byClass[class] = m
+	}
+	for i, right := range parts[1:] {
+		left := parts[i]
+		gOverlap := left.Genomic.Right - right.Genomic.Left
+		m[0] = append(m[0], gOverlap)
+		if left.Left == chain.None || right.Left == chain.None {
+			continue
+		}
+		var rOverlap int
+		if strand == seq.Plus {
+			rOverlap = left.Right - right.Left
+		} else {
+			rOverlap = right.Right - left.Left
+		}
+		m[1] = append(m[1], rOverlap)
+		m[2] = append(m[2], gOverlap-rOverlap)
+	}
+}
+
+func (d *distances) classes() []string {
+	c := make([]string, 0, len(d.byClass))
+	for k := range d.byClass {
+		c = append(c, k)
+	}
+	sort.Strings(c)
+	return c
+}
+
+// quantile returns the q quantile of the sorted values in v using the
+// nearest rank.
+func quantile(v []int, q float64) int {
+	i := int(math.Ceil(q*float64(len(v)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return v[i]
+}
+
+// writeQuantiles writes the number of links, the mean and the quantiles of
+// each measure for each class to w.
+func (d *distances) writeQuantiles(w io.Writer) error {
+	fmt.Fprint(w, "class\tmeasure\tn\tmean")
+	for _, q := range quantiles {
+		fmt.Fprintf(w, "\tq%g", q*100)
+	}
+	_, err := fmt.Fprintln(w)
+	if err != nil {
+		return err
+	}
+	for _, c := range d.classes() {
+		for i, v := range d.byClass[c] {
+			if len(v) == 0 {
+				continue
+			}
+			sort.Ints(v)
+			var sum float64
+			for _, e := range v {
+				sum += float64(e)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%.4g", c, measures[i], len(v), sum/float64(len(v)))
+			for _, q := range quantiles {
+				fmt.Fprintf(w, "\t%d", quantile(v, q))
+			}
+			_, err = fmt.Fprintln(w)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// histogram returns the counts of v in bins of d.width over [-d.limit, d.limit).
+// Values outside that range are counted in the first or last bin.
+func (d *distances) histogram(v []int) []int {
+	n := (2*d.limit + d.width - 1) / d.width
+	h := make([]int, n)
+	for _, e := range v {
+		b := (e + d.limit) / d.width
+		switch {
+		case e < -d.limit:
+			b = 0
+		case b >= n:
+			b = n - 1
+		}
+		h[b]++
+	}
+	return h
+}
+
+// writeHistograms writes the histogram of each measure for each class to w.
+// The first and last bins of each histogram extend to infinity.
+func (d *distances) writeHistograms(w io.Writer) error {
+	_, err := fmt.Fprintln(w, "class\tmeasure\tbin_start\tbin_end\tcount")
+	if err != nil {
+		return err
+	}
+	for _, c := range d.classes() {
+		for i, v := range d.byClass[c] {
+			if len(v) == 0 {
+				continue
+			}
+			h := d.histogram(v)
+			for b, n := range h {
+				start := fmt.Sprint(b*d.width - d.limit)
+				end := fmt.Sprint((b+1)*d.width - d.limit)
+				if b == 0 {
+					start = "-inf"
+				}
+				if b == len(h)-1 {
+					end = "inf"
+				}
+				_, err = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\n", c, measures[i], start, end, n)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Dimensions of histogram panels in the SVG plot.
+const (
+	panelWidth  = 300
+	panelHeight = 150
+	margin      = 30
+)
+
+// writeSVG writes the histograms as an SVG plot to w, with one row of panels
+// for each class and one column for each measure. Each panel is scaled to its
+// largest bin and the position of zero is marked.
+func (d *distances) writeSVG(w io.Writer) error {
+	classes := d.classes()
+	width := len(measures)*(panelWidth+margin) + margin
+	height := len(classes)*(panelHeight+2*margin) + margin
+	_, err := fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="10">
+`, width, height)
+	if err != nil {
+		return err
+	}
+	for row, c := range classes {
+		for col, v := range d.byClass[c] {
+			x := margin + col*(panelWidth+margin)
+			y := margin + row*(panelHeight+2*margin)
+			fmt.Fprintf(w, `<text x="%d" y="%d">%s %s (n=%d)</text>
+`, x, y-5, html.EscapeString(c), measures[col], len(v))
+			fmt.Fprintf(w, `<rect x="%d" y="%d" width="%d" height="%d" fill="none" stroke="black"/>
+`, x, y, panelWidth, panelHeight)
+			if len(v) == 0 {
+				continue
+			}
+			h := d.histogram(v)
+			max := 0
+			for _, n := range h {
+				if n > max {
+					max = n
+				}
+			}
+			bw := float64(panelWidth) / float64(len(h))
+			for b, n := range h {
+				if n == 0 {
+					continue
+				}
+				bh := float64(panelHeight) * float64(n) / float64(max)
+				fmt.Fprintf(w, `<rect x="%.2f" y="%.2f" width="%.2f" height="%.2f" fill="steelblue"/>
+`, float64(x)+float64(b)*bw, float64(y+panelHeight)-bh, bw, bh)
+			}
+			zero := float64(x) + float64(panelWidth)*float64(d.limit)/float64(len(h)*d.width)
+			fmt.Fprintf(w, `<line x1="%.2f" y1="%d" x2="%.2f" y2="%d" stroke="red" stroke-dasharray="2,2"/>
+`, zero, y, zero, y+panelHeight)
+			fmt.Fprintf(w, `<text x="%d" y="%d">%d</text>
+<text x="%.2f" y="%d" text-anchor="middle">0</text>
+<text x="%d" y="%d" text-anchor="end">%d</text>
+`, x, y+panelHeight+12, -d.limit, zero, y+panelHeight+12, x+panelWidth, y+panelHeight+12, len(h)*d.width-d.limit)
+			_, err = fmt.Fprintf(w, `<text x="%d" y="%d" text-anchor="end">%d</text>
+`, x+panelWidth-3, y+12, max)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	_, err = fmt.Fprintln(w, "</svg>")
+	return err
+}
+
+// writeFile writes to the named file using fn.
+func writeFile(name string, fn func(io.Writer) error) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("could not create %q: %v", name, err)
+	}
+	err = fn(f)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %q: %v", name, err)
+	}
+	return f.Close()
+}
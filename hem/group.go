@@ -0,0 +1,203 @@
+// Copyright ©2015 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/biogo/biogo/feat"
+	"github.com/biogo/biogo/io/featio/gff"
+
+	"github.com/kortschak/quilt/overlap"
+)
+
+// tally counts the composites, parts and discordant composites in a group.
+type tally struct {
+	composites, parts, discords int
+}
+
+func (t *tally) add(parts int, discord bool) {
+	t.composites++
+	t.parts += parts
+	if discord {
+		t.discords++
+	}
+}
+
+// groups holds the tallies of composites grouped by a label such as a
+// chromosome or region name, and the length of the sequence in each group.
+type groups struct {
+	tally  map[string]*tally
+	length map[string]int
+}
+
+func newGroups() *groups {
+	return &groups{tally: make(map[string]*tally), length: make(map[string]int)}
+}
+
+func (g *groups) add(label string, parts int, discord bool) {
+	t, ok := g.tally[label]
+	if !ok {
+		t = &tally{}
+		g.tally[label] = t
+	}
+	t.add(parts, discord)
+}
+
+// groupStats holds the composite statistics for a group.
+type groupStats struct {
+	Name         string   `json:"name"`
+	Length       int      `json:"length,omitempty"`
+	Parts        int      `json:"parts_merged"`
+	Composites   int      `json:"composites"`
+	Condensation float64  `json:"condensation"`
+	Discords     int      `json:"discord_count"`
+	DiscordFreq  float64  `json:"discord_freq"`
+	Density      *float64 `json:"density_per_mb"`
+}
+
+// stats returns the statistics for each group in g, sorted by label. Groups
+// with a known length but no composites are included.
+func (g *groups) stats() []groupStats {
+	labels := make([]string, 0, len(g.tally))
+	for l := range g.tally {
+		labels = append(labels, l)
+	}
+	for l := range g.length {
+		if _, ok := g.tally[l]; !ok {
+			labels = append(labels, l)
+		}
+	}
+	sort.Strings(labels)
+
+	s := make([]groupStats, 0, len(labels))
+	for _, l := range labels {
+		var t tally
+		if p, ok := g.tally[l]; ok {
+			t = *p
+		}
+		gs := groupStats{
+			Name:       l,
+			Length:     g.length[l],
+			Parts:      t.parts,
+			Composites: t.composites,
+			Discords:   t.discords,
+		}
+		if t.composites != 0 {
+			gs.Condensation = float64(t.parts) / float64(t.composites)
+			gs.DiscordFreq = float64(t.discords) / float64(t.composites)
+		}
+		if gs.Length != 0 {
+			d := float64(t.composites) / float64(gs.Length) * 1e6
+			gs.Density = &d
+		}
+		s = append(s, gs)
+	}
+	return s
+}
+
+// writeGroups writes the group statistics in s to w as tab separated values,
+// or aligned for reading if table is true. Unknown lengths and densities are
+// written as ".".
+func writeGroups(w io.Writer, s []groupStats, table bool) error {
+	var tw *tabwriter.Writer
+	if table {
+		tw = tabwriter.NewWriter(w, 0, 0, 1, ' ', tabwriter.Debug)
+		w = tw
+	}
+	fmt.Fprintln(w, "name\tlength\tparts_merged\tcomposites\tcondensation\tdiscord_count\tdiscord_freq\tdensity_per_mb")
+	for _, g := range s {
+		length, density := ".", "."
+		if g.Length != 0 {
+			length = fmt.Sprint(g.Length)
+		}
+		if g.Density != nil {
+			density = fmt.Sprintf("%.4g", *g.Density)
+		}
+		_, err := fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%.4g\t%d\t%.4g\t%s\n",
+			g.Name, length, g.Parts, g.Composites, g.Condensation, g.Discords, g.DiscordFreq, density,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	if tw != nil {
+		return tw.Flush()
+	}
+	return nil
+}
+
+// region is a named BED interval.
+type region struct {
+	*gff.Feature
+	name string
+}
+
+// readRegions returns an overlap.Tree holding the regions in the named BED
+// file. Regions are named by the BED name field, or by their location if the
+// name is absent. The total length of the regions with each name is recorded
+// in g.
+func (g *groups) readRegions(file string) (*overlap.Tree, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %q: %v", file, err)
+	}
+	defer f.Close()
+
+	t := overlap.NewTree()
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		b := bytes.TrimSpace(sc.Bytes())
+		if len(b) == 0 || b[0] == '#' || bytes.HasPrefix(b, []byte("track")) || bytes.HasPrefix(b, []byte("browser")) {
+			continue
+		}
+		fields := strings.Split(string(b), "\t")
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("too few fields on line %d of %q", line, file)
+		}
+		start, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse start on line %d of %q: %v", line, file, err)
+		}
+		end, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse end on line %d of %q: %v", line, file, err)
+		}
+		var name string
+		if len(fields) > 3 && fields[3] != "" {
+			name = fields[3]
+		} else {
+			name = fmt.Sprintf("%s:%d-%d", fields[0], feat.ZeroToOne(start), end)
+		}
+		t.Insert(region{Feature: &gff.Feature{SeqName: fields[0], FeatStart: start, FeatEnd: end}, name: name})
+		g.length[name] += end - start
+	}
+	if sc.Err() != nil {
+		return nil, fmt.Errorf("failed to read %q: %v", file, sc.Err())
+	}
+	return t, nil
+}
+
+// addRegions adds a composite to the group of each named region in t that
+// it overlaps.
+func (g *groups) addRegions(t *overlap.Tree, f *gff.Feature, parts int, discord bool) {
+	seen := make(map[string]bool)
+	t.Find(f, func(ref feat.Feature) {
+		name := ref.(region).name
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		g.add(name, parts, discord)
+	})
+}
@@ -4,9 +4,36 @@
 
 // hem performs a basic analysis of the result of running stitch on a set
 // of repeat annotations.
+//
+// Composites written by stitch and by patchwork are analysed. For patchwork
+// composites with insertions, the TinT attribute is also summarised: the number
+// of composites with insertions, the number of insertions of each major class,
+// the first element of the class, into each host class, and the distribution of
+// insertion lengths for each major class. In table output, this summary
+// follows the class statistics, headed by "# insertions" and
+// "# insertion lengths".
+//
+// For each repeat class, hem reports the number of parts merged into
+// composites, the number of composites, the condensation (parts per
+// composite) and the number and frequency of discordant composites, those
+// whose parts are not all of the same repeat name. The -format flag selects
+// the output format. The default, table, is intended for reading. With tsv,
+// a header line is followed by one line per class and a final line for the
+// class "total". With json, a single object holding the input parameters, the
+// per-class statistics and the totals is written.
+//
+// Table and json output also hold any chromosome, region, insertion and
+// confusion matrix statistics. So that each tsv file holds a single table,
+// these are instead written with tsv output to files named by the -prefix
+// value and the suffixes .chromosomes.tsv, .regions.tsv, .insertions.tsv,
+// .insertion_lengths.tsv and .confusion.tsv. The confusion matrices of all
+// classes are written as a single table with one line for each class and pair
+// of names. The number of composites with insertions is only given in table
+// and json output.
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
@@ -14,16 +41,32 @@ import (
 	"os"
 	"sort"
 	"strconv"
-	"strings"
 	"text/tabwriter"
 
 	"github.com/biogo/biogo/io/featio/gff"
+
+	"github.com/kortschak/quilt/chain"
+	"github.com/kortschak/quilt/genome"
+	"github.com/kortschak/quilt/overlap"
 )
 
 var (
 	inFile   = flag.String("in", "", "Filename for stitch checking.")
 	discords = flag.Bool("discords", false, "Output discordant features to stderr.")
-	help     = flag.Bool("help", false, "Print this usage message.")
+	format   = flag.String("format", "table", "Output format: table, tsv or json.")
+	prefix   = flag.String("prefix", "", "Filename prefix to write additional tsv tables to.")
+	confuse  = flag.Bool("confusion", false, "Report the repeat name confusion matrix for each class.")
+
+	distPrefix = flag.String("dist", "", "Filename prefix to write part distance distributions to.")
+	binWidth   = flag.Int("bin-width", 50, "Width of distance histogram bins.")
+	distLimit  = flag.Int("dist-limit", 2000, "Absolute distance beyond which histogram values are collected in the end bins.")
+	plot       = flag.Bool("svg", false, "Plot distance histograms as SVG.")
+
+	byChrom     = flag.Bool("by-chrom", false, "Report statistics for each chromosome.")
+	regionsFile = flag.String("regions", "", "Filename for BED regions to report statistics for.")
+	lengthsFile = flag.String("lengths", "", "Filename for tab separated chromosome lengths.")
+
+	help = flag.Bool("help", false, "Print this usage message.")
 )
 
 func main() {
@@ -32,6 +75,17 @@ func main() {
 		flag.Usage()
 		os.Exit(0)
 	}
+	switch *format {
+	case "table", "tsv", "json":
+	default:
+		log.Fatalf("unknown output format: %q", *format)
+	}
+	if *format == "tsv" && *prefix == "" && (*confuse || *byChrom || *regionsFile != "") {
+		log.Fatal("tsv output of confusion, chromosome or region statistics requires -prefix")
+	}
+	if *binWidth < 1 || *distLimit < 1 {
+		log.Fatal("bin width and distance limit must be positive")
+	}
 
 	f, err := os.Open(*inFile)
 	if err != nil {
@@ -53,7 +107,35 @@ func main() {
 		partsIn   = make(map[string]int)
 		discordIn = make(map[string]int)
 		allIn     = make(map[string]int)
+		confIn    = make(map[string]*confusion)
+
+		dist *distances
+
+		chroms  *groups
+		regions *groups
+		tree    *overlap.Tree
+
+		inserts *insertions
 	)
+	if *distPrefix != "" {
+		dist = newDistances(*binWidth, *distLimit)
+	}
+	if *byChrom {
+		chroms = newGroups()
+		if *lengthsFile != "" {
+			chroms.length, err = genome.ReadLengths(*lengthsFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	if *regionsFile != "" {
+		regions = newGroups()
+		tree, err = regions.readRegions(*regionsFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 	for {
 		f, err := in.Read()
 		if err != nil {
@@ -64,7 +146,7 @@ func main() {
 		}
 
 		gf := f.(*gff.Feature)
-		if gf.Source != "stitch" {
+		if gf.Source != "stitch" && gf.Source != "patch" {
 			continue
 		}
 		n++
@@ -81,18 +163,39 @@ func main() {
 		if p == "" {
 			log.Fatal("missing parts tag: file not a valid stitch gff.")
 		}
-		p, err = strconv.Unquote(p)
+		parts, err := chain.ParseParts(p, gf.SeqName, gf.FeatStrand)
 		if err != nil {
-			log.Fatalf("failed to unquote parts: %v", err)
+			log.Fatalf("failed to parse parts: %v", err)
 		}
 		allIn[class]++
+		if gf.Source == "patch" {
+			if inserts == nil {
+				inserts = newInsertions()
+			}
+			err = inserts.add(class, gf.FeatAttributes.Get("TinT"))
+			if err != nil {
+				log.Fatalf("failed to parse insertions: %v", err)
+			}
+		}
 
-		parts := strings.Split(p, "|")
 		partsIn[class] += len(parts)
 		merged += len(parts)
-		first := strings.Fields(parts[0])[0]
+		if *confuse {
+			c, ok := confIn[class]
+			if !ok {
+				c = newConfusion()
+				confIn[class] = c
+			}
+			c.add(parts)
+		}
+		if dist != nil {
+			dist.add(class, gf.FeatStrand, parts)
+		}
+		var discord bool
+		first := parts[0].Name
 		for _, p := range parts[1:] {
-			if strings.Fields(p)[0] != first {
+			if p.Name != first {
+				discord = true
 				discordIn[class]++
 				if w != nil {
 					w.Write(gf)
@@ -100,6 +203,12 @@ func main() {
 				break
 			}
 		}
+		if chroms != nil {
+			chroms.add(gf.SeqName, len(parts), discord)
+		}
+		if regions != nil {
+			regions.addRegions(tree, gf, len(parts), discord)
+		}
 	}
 
 	names := make([]string, 0, len(allIn))
@@ -107,14 +216,296 @@ func main() {
 		names = append(names, c)
 	}
 	sort.Strings(names)
-	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.Debug)
-	fmt.Fprintln(tw, "class\t parts merged\t composites\t condensation\t discord count\t discord freq")
+	if dist != nil {
+		err = writeFile(*distPrefix+".quantiles.tsv", dist.writeQuantiles)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = writeFile(*distPrefix+".hist.tsv", dist.writeHistograms)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *plot {
+			err = writeFile(*distPrefix+".svg", dist.writeSVG)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	r := report{Params: params{
+		In:        *inFile,
+		Confusion: *confuse,
+		Dist:      *distPrefix,
+		BinWidth:  *binWidth,
+		DistLimit: *distLimit,
+		ByChrom:   *byChrom,
+		Regions:   *regionsFile,
+		Lengths:   *lengthsFile,
+	}}
+	if chroms != nil {
+		r.Chromosomes = chroms.stats()
+	}
+	if regions != nil {
+		r.Regions = regions.stats()
+	}
+	if inserts != nil {
+		r.Insertions = inserts.stats()
+	}
+	var discordant int
 	for _, c := range names {
+		s := newStats(c, partsIn[c], allIn[c], discordIn[c])
+		if *confuse {
+			s.Confusion = confIn[c].stats()
+		}
+		r.Classes = append(r.Classes, s)
+		discordant += discordIn[c]
+	}
+	r.Totals = newStats("total", merged, n, discordant)
+
+	switch *format {
+	case "table":
+		err = r.writeTable(os.Stdout)
+	case "tsv":
+		err = r.writeTSV(os.Stdout)
+		if err == nil {
+			err = r.writeTables(*prefix)
+		}
+	case "json":
+		err = r.writeJSON(os.Stdout)
+	}
+	if err != nil {
+		log.Fatalf("failed to write report: %v", err)
+	}
+}
+
+// report is the complete set of statistics for a stitch result.
+type report struct {
+	Params  params  `json:"params"`
+	Classes []stats `json:"classes"`
+	Totals  stats   `json:"totals"`
+
+	Chromosomes []groupStats `json:"chromosomes,omitempty"`
+	Regions     []groupStats `json:"regions,omitempty"`
+
+	Insertions *insertionStats `json:"insertions,omitempty"`
+}
+
+// params holds the input parameters of a report.
+type params struct {
+	In        string `json:"in"`
+	Confusion bool   `json:"confusion"`
+	Dist      string `json:"dist,omitempty"`
+	BinWidth  int    `json:"bin_width"`
+	DistLimit int    `json:"dist_limit"`
+	ByChrom   bool   `json:"by_chrom"`
+	Regions   string `json:"regions,omitempty"`
+	Lengths   string `json:"lengths,omitempty"`
+}
+
+// stats holds the composite statistics for a single class or
+// for all classes.
+type stats struct {
+	Class        string  `json:"class"`
+	Parts        int     `json:"parts_merged"`
+	Composites   int     `json:"composites"`
+	Condensation float64 `json:"condensation"`
+	Discords     int     `json:"discord_count"`
+	DiscordFreq  float64 `json:"discord_freq"`
+
+	Confusion *confusionStats `json:"confusion,omitempty"`
+}
+
+func newStats(class string, parts, composites, discords int) stats {
+	s := stats{
+		Class:      class,
+		Parts:      parts,
+		Composites: composites,
+		Discords:   discords,
+	}
+	if composites != 0 {
+		s.Condensation = float64(parts) / float64(composites)
+		s.DiscordFreq = float64(discords) / float64(composites)
+	}
+	return s
+}
+
+func (r report) writeTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', tabwriter.Debug)
+	fmt.Fprintln(tw, "class\t parts merged\t composites\t condensation\t discord count\t discord freq")
+	for _, c := range r.Classes {
 		fmt.Fprintf(tw, "%s\t%12d\t%10d\t    % .2f\t%13d\t   % .3f\n",
-			c, partsIn[c], allIn[c], float64(partsIn[c])/float64(allIn[c]),
-			discordIn[c], float64(discordIn[c])/float64(allIn[c]),
+			c.Class, c.Parts, c.Composites, c.Condensation, c.Discords, c.DiscordFreq,
 		)
 	}
-	tw.Flush()
-	fmt.Printf("\ntotal composited: %d comprising: %d\n", n, merged)
+	err := tw.Flush()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "\ntotal composited: %d comprising: %d\n", r.Totals.Composites, r.Totals.Parts)
+	if err != nil {
+		return err
+	}
+	err = r.writeGroups(w)
+	if err != nil {
+		return err
+	}
+	err = r.writeInsertions(w)
+	if err != nil {
+		return err
+	}
+	return r.writeConfusion(w)
+}
+
+// writeTSV writes the class statistics of r to w as tab separated values.
+func (r report) writeTSV(w io.Writer) error {
+	_, err := fmt.Fprintln(w, "class\tparts_merged\tcomposites\tcondensation\tdiscord_count\tdiscord_freq")
+	if err != nil {
+		return err
+	}
+	for _, c := range append(r.Classes, r.Totals) {
+		_, err = fmt.Fprintf(w, "%s\t%d\t%d\t%.4g\t%d\t%.4g\n",
+			c.Class, c.Parts, c.Composites, c.Condensation, c.Discords, c.DiscordFreq,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTables writes the chromosome, region, insertion and confusion
+// statistics of r that are present to tab separated files named with
+// the given prefix. If prefix is empty, any insertion statistics are
+// not written.
+func (r report) writeTables(prefix string) error {
+	if prefix == "" {
+		if r.Insertions != nil {
+			log.Print("insertion statistics not written: use -prefix or json output")
+		}
+		return nil
+	}
+	var hasConfusion bool
+	for _, c := range r.Classes {
+		if c.Confusion != nil {
+			hasConfusion = true
+			break
+		}
+	}
+	for _, t := range []struct {
+		suffix  string
+		present bool
+		write   func(io.Writer) error
+	}{
+		{
+			suffix:  ".chromosomes.tsv",
+			present: r.Chromosomes != nil,
+			write:   func(w io.Writer) error { return writeGroups(w, r.Chromosomes, false) },
+		},
+		{
+			suffix:  ".regions.tsv",
+			present: r.Regions != nil,
+			write:   func(w io.Writer) error { return writeGroups(w, r.Regions, false) },
+		},
+		{
+			suffix:  ".insertions.tsv",
+			present: r.Insertions != nil,
+			write:   func(w io.Writer) error { return r.Insertions.writePairs(w, false) },
+		},
+		{
+			suffix:  ".insertion_lengths.tsv",
+			present: r.Insertions != nil,
+			write:   func(w io.Writer) error { return r.Insertions.writeLengths(w, false) },
+		},
+		{
+			suffix:  ".confusion.tsv",
+			present: hasConfusion,
+			write:   func(w io.Writer) error { return writeConfusionTSV(w, r.Classes) },
+		},
+	} {
+		if !t.present {
+			continue
+		}
+		err := writeFile(prefix+t.suffix, t.write)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeGroups writes the chromosome and region statistics of r, if
+// present, each preceded by a blank line and a title line.
+func (r report) writeGroups(w io.Writer) error {
+	for _, g := range []struct {
+		title string
+		stats []groupStats
+	}{
+		{title: "chromosomes", stats: r.Chromosomes},
+		{title: "regions", stats: r.Regions},
+	} {
+		if g.stats == nil {
+			continue
+		}
+		_, err := fmt.Fprintf(w, "\n# %s\n", g.title)
+		if err != nil {
+			return err
+		}
+		err = writeGroups(w, g.stats, true)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeInsertions writes the insertion summary of r, if present,
+// preceded by a blank line. Host and inserted class counts are headed
+// by "# insertions" and length distributions by "# insertion lengths".
+func (r report) writeInsertions(w io.Writer) error {
+	if r.Insertions == nil {
+		return nil
+	}
+	_, err := fmt.Fprintf(w, "\n# insertions: with_insertions=%d insertions=%d\n", r.Insertions.WithInsertions, r.Insertions.Insertions)
+	if err != nil {
+		return err
+	}
+	err = r.Insertions.writePairs(w, true)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(w, "\n# insertion lengths\n")
+	if err != nil {
+		return err
+	}
+	return r.Insertions.writeLengths(w, true)
+}
+
+// writeConfusion writes the confusion matrix of each class in r, if
+// present, preceded by a blank line and a line holding "# " and the
+// class.
+func (r report) writeConfusion(w io.Writer) error {
+	for _, c := range r.Classes {
+		if c.Confusion == nil {
+			continue
+		}
+		_, err := fmt.Fprintf(w, "\n# %s\n", c.Class)
+		if err != nil {
+			return err
+		}
+		err = c.Confusion.writeTable(w)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r report) writeJSON(w io.Writer) error {
+	b, err := json.MarshalIndent(r, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
 }
@@ -0,0 +1,209 @@
+// Copyright ©2015 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// insertions records the TinT insertions of patchwork composites.
+type insertions struct {
+	hosts int
+
+	// pairs is the number of insertions of each
+	// major class into each host class.
+	pairs map[[2]string]int
+
+	// lengths holds the lengths of insertions
+	// of each major class.
+	lengths map[string][]int
+}
+
+func newInsertions() *insertions {
+	return &insertions{
+		pairs:   make(map[[2]string]int),
+		lengths: make(map[string][]int),
+	}
+}
+
+// add adds the insertions described by the TinT attribute value tint
+// of a patchwork composite of the given class to ins.
+func (ins *insertions) add(class, tint string) error {
+	if tint == "" {
+		return nil
+	}
+	i := strings.IndexByte(tint, ' ')
+	if i < 0 {
+		return fmt.Errorf("bad TinT attribute: %q", tint)
+	}
+	n, err := strconv.Atoi(tint[:i])
+	if err != nil {
+		return fmt.Errorf("failed to parse insertion count: %v", err)
+	}
+	if n == 0 {
+		return nil
+	}
+	list, err := strconv.Unquote(tint[i+1:])
+	if err != nil {
+		return fmt.Errorf("failed to unquote insertions: %v", err)
+	}
+	ins.hosts++
+	for _, e := range strings.Split(list, "|") {
+		fields := strings.Fields(e)
+		if len(fields) != 4 {
+			return fmt.Errorf("unexpected number of fields in insertion %q", e)
+		}
+		start, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return fmt.Errorf("failed to parse insertion start: %v", err)
+		}
+		end, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return fmt.Errorf("failed to parse insertion end: %v", err)
+		}
+		inserted := majorClass(fields[0])
+		ins.pairs[[2]string{class, inserted}]++
+		ins.lengths[inserted] = append(ins.lengths[inserted], end-start+1)
+	}
+	return nil
+}
+
+// majorClass returns the first element of a repeat class or TinT label.
+// Labels for simple repeats in TinT attributes hold the repeat name as well as
+// the class, so only the major class is unambiguous.
+func majorClass(label string) string {
+	if i := strings.IndexByte(label, '/'); i >= 0 {
+		return label[:i]
+	}
+	return label
+}
+
+// insertionStats summarises the insertions of patchwork composites.
+type insertionStats struct {
+	WithInsertions int `json:"with_insertions"`
+	Insertions     int `json:"insertions"`
+
+	Pairs   []insertionPair   `json:"pairs"`
+	Lengths []insertionLength `json:"lengths"`
+}
+
+// insertionPair is the number of insertions of a major class
+// into a host class.
+type insertionPair struct {
+	Host     string `json:"host"`
+	Inserted string `json:"inserted"`
+	Count    int    `json:"count"`
+}
+
+// insertionLength is the distribution of lengths of the insertions
+// of a major class, or of all insertions for the class "total".
+// Quantiles are the 0, 5, 25, 50, 75, 95 and 100th percentiles.
+type insertionLength struct {
+	Class     string  `json:"class"`
+	N         int     `json:"n"`
+	Mean      float64 `json:"mean"`
+	Quantiles []int   `json:"quantiles"`
+}
+
+func (ins *insertions) stats() *insertionStats {
+	s := &insertionStats{WithInsertions: ins.hosts}
+	for p, n := range ins.pairs {
+		s.Pairs = append(s.Pairs, insertionPair{Host: p[0], Inserted: p[1], Count: n})
+		s.Insertions += n
+	}
+	sort.Sort(byPair(s.Pairs))
+
+	classes := make([]string, 0, len(ins.lengths))
+	var all []int
+	for c, l := range ins.lengths {
+		classes = append(classes, c)
+		all = append(all, l...)
+	}
+	sort.Strings(classes)
+	for _, c := range classes {
+		s.Lengths = append(s.Lengths, lengthStats(c, ins.lengths[c]))
+	}
+	if len(all) != 0 {
+		s.Lengths = append(s.Lengths, lengthStats("total", all))
+	}
+	return s
+}
+
+func lengthStats(class string, v []int) insertionLength {
+	sort.Ints(v)
+	l := insertionLength{Class: class, N: len(v)}
+	var sum float64
+	for _, e := range v {
+		sum += float64(e)
+	}
+	l.Mean = sum / float64(len(v))
+	for _, q := range quantiles {
+		l.Quantiles = append(l.Quantiles, quantile(v, q))
+	}
+	return l
+}
+
+// writePairs writes the host and inserted class counts to w as tab
+// separated values, or aligned for reading if table is true.
+func (s *insertionStats) writePairs(w io.Writer, table bool) error {
+	var tw *tabwriter.Writer
+	if table {
+		tw = tabwriter.NewWriter(w, 0, 0, 1, ' ', tabwriter.Debug)
+		w = tw
+	}
+	fmt.Fprintln(w, "host\tinserted\tcount")
+	for _, p := range s.Pairs {
+		_, err := fmt.Fprintf(w, "%s\t%s\t%d\n", p.Host, p.Inserted, p.Count)
+		if err != nil {
+			return err
+		}
+	}
+	if tw != nil {
+		return tw.Flush()
+	}
+	return nil
+}
+
+// writeLengths writes the insertion length distributions to w as tab
+// separated values, or aligned for reading if table is true.
+func (s *insertionStats) writeLengths(w io.Writer, table bool) error {
+	var tw *tabwriter.Writer
+	if table {
+		tw = tabwriter.NewWriter(w, 0, 0, 1, ' ', tabwriter.Debug)
+		w = tw
+	}
+	fmt.Fprint(w, "class\tn\tmean")
+	for _, q := range quantiles {
+		fmt.Fprintf(w, "\tq%g", q*100)
+	}
+	fmt.Fprintln(w)
+	for _, l := range s.Lengths {
+		fmt.Fprintf(w, "%s\t%d\t%.4g", l.Class, l.N, l.Mean)
+		for _, q := range l.Quantiles {
+			fmt.Fprintf(w, "\t%d", q)
+		}
+		_, err := fmt.Fprintln(w)
+		if err != nil {
+			return err
+		}
+	}
+	if tw != nil {
+		return tw.Flush()
+	}
+	return nil
+}
+
+type byPair []insertionPair
+
+func (p byPair) Len() int { return len(p) }
+func (p byPair) Less(i, j int) bool {
+	return p[i].Host < p[j].Host || (p[i].Host == p[j].Host && p[i].Inserted < p[j].Inserted)
+}
+func (p byPair) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
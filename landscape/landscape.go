@@ -0,0 +1,388 @@
+// Copyright ©2015 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// landscape builds repeat landscapes, histograms of genome coverage by
+// divergence from the consensus, for each repeat class.
+//
+// Repeat features are read from the GFF files named on the command line, or
+// from stdin if no files are given. Features must carry a Div attribute, as
+// written by rm2gff, stitch and rmstitch; features without one are counted and
+// ignored. Simple repeats, features with a Repeat attribute, contribute their
+// genomic length at their divergence. Composites, features with a Parts
+// attribute, contribute the total length of their parts, excluding any
+// insertions between the parts, at the length-weighted divergence of their
+// parts. Running landscape on converted annotation and again on stitch
+// composites with tailored simple repeats allows landscapes built from
+// fragments to be compared with those built from reconstructed elements.
+//
+// Coverage is binned by divergence in bins of -bin percent up to -max percent;
+// greater divergences are counted in the last bin. Classes are reported in
+// full, or by major class, the part of the class before any '/', with -level
+// major. The landscape is written to stdout as tab separated class, bin start,
+// bin end, bases and fraction of the genome. The fraction is given if the
+// genome length is known from the -lengths file of tab separated sequence names
+// and lengths, or from the -genome fasta file, and is written as "." otherwise.
+// If -svg is given, the landscape is also plotted as a stacked bar chart to the
+// named file, with a distinct colour for each reported class.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/biogo/biogo/io/featio/gff"
+
+	"github.com/kortschak/quilt/chain"
+	"github.com/kortschak/quilt/genome"
+)
+
+var (
+	binWidth    = flag.Float64("bin", 1, "Width of divergence bins in percent.")
+	maxDiv      = flag.Float64("max", 50, "Maximum divergence in percent; greater divergences are counted in the last bin.")
+	level       = flag.String("level", "class", "Class level to report: class or major.")
+	lengthsFile = flag.String("lengths", "", "Filename for tab separated sequence lengths.")
+	genomeFile  = flag.String("genome", "", "Filename for genome fasta.")
+	svgFile     = flag.String("svg", "", "Filename to write an SVG plot of the landscape to.")
+	help        = flag.Bool("help", false, "Print this usage message.")
+)
+
+func main() {
+	flag.Parse()
+	if *help {
+		flag.Usage()
+		os.Exit(0)
+	}
+	if *binWidth <= 0 || *maxDiv <= 0 {
+		log.Fatal("bin width and maximum divergence must be positive")
+	}
+	switch *level {
+	case "class", "major":
+	default:
+		log.Fatalf("unknown class level: %q", *level)
+	}
+
+	length, err := genome.Length(*lengthsFile, *genomeFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	l := newLandscape(*binWidth, *maxDiv, *level == "major")
+	if len(flag.Args()) == 0 {
+		err = l.read(os.Stdin)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	for _, file := range flag.Args() {
+		f, err := os.Open(file)
+		if err != nil {
+			log.Fatalf("could not open %q: %v", file, err)
+		}
+		fmt.Fprintf(os.Stderr, "reading repeat features from %q\n", file)
+		err = l.read(f)
+		f.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if l.missing != 0 {
+		log.Printf("%d features without divergence ignored", l.missing)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	err = l.writeTSV(w, length)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		log.Fatalf("failed to write landscape: %v", err)
+	}
+
+	if *svgFile != "" {
+		f, err := os.Create(*svgFile)
+		if err != nil {
+			log.Fatalf("could not create %q: %v", *svgFile, err)
+		}
+		err = l.writeSVG(f, length)
+		if err != nil {
+			log.Fatalf("failed to write %q: %v", *svgFile, err)
+		}
+		err = f.Close()
+		if err != nil {
+			log.Fatalf("failed to close %q: %v", *svgFile, err)
+		}
+	}
+}
+
+// landscape holds the number of bases in each divergence bin for
+// each class.
+type landscape struct {
+	width float64
+	bins  int
+	major bool
+
+	bases map[string][]int
+
+	// missing is the number of features
+	// without a divergence.
+	missing int
+}
+
+func newLandscape(width, max float64, major bool) *landscape {
+	n := int(max / width)
+	if float64(n)*width < max {
+		n++
+	}
+	return &landscape{width: width, bins: n, major: major, bases: make(map[string][]int)}
+}
+
+// add adds n bases of the given class at divergence div to l.
+func (l *landscape) add(class string, div float64, n int) {
+	if l.major {
+		if i := strings.Index(class, "/"); i >= 0 {
+			class = class[:i]
+		}
+	}
+	b, ok := l.bases[class]
+	if !ok {
+		b = make([]int, l.bins)
+		l.bases[class] = b
+	}
+	i := int(div / l.width)
+	switch {
+	case i < 0:
+		i = 0
+	case i >= l.bins:
+		i = l.bins - 1
+	}
+	b[i] += n
+}
+
+// read adds the repeat features read from r to l.
+func (l *landscape) read(r io.Reader) error {
+	in := gff.NewReader(r)
+	for {
+		f, err := in.Read()
+		if err != nil {
+			if err != io.EOF {
+				return fmt.Errorf("failed to read source feature: %v", err)
+			}
+			return nil
+		}
+		gf := f.(*gff.Feature)
+
+		var (
+			class string
+			n     int
+		)
+		switch {
+		case gf.FeatAttributes.Get("Parts") != "":
+			class, err = strconv.Unquote(gf.FeatAttributes.Get("Class"))
+			if err != nil {
+				return fmt.Errorf("failed to unquote class: %v", err)
+			}
+			parts, err := chain.ParseParts(gf.FeatAttributes.Get("Parts"), gf.SeqName, gf.FeatStrand)
+			if err != nil {
+				return err
+			}
+			n = partsLength(parts)
+		case gf.FeatAttributes.Get("Repeat") != "":
+			fields := strings.Fields(gf.FeatAttributes.Get("Repeat"))
+			if len(fields) < 2 {
+				return fmt.Errorf("bad repeat attribute: %v", gf)
+			}
+			class = fields[1]
+			n = gf.FeatEnd - gf.FeatStart
+		default:
+			continue
+		}
+
+		d := gf.FeatAttributes.Get("Div")
+		if d == "" {
+			l.missing++
+			continue
+		}
+		div, err := strconv.ParseFloat(d, 64)
+		if err != nil {
+			return fmt.Errorf("failed to parse divergence: %v", err)
+		}
+		l.add(class, div, n)
+	}
+}
+
+// partsLength returns the number of genomic bases covered by parts.
+func partsLength(parts chain.Parts) int {
+	iv := make([][2]int, len(parts))
+	for i, p := range parts {
+		iv[i] = [2]int{p.Genomic.Left, p.Genomic.Right}
+	}
+	return genome.Bases(iv)
+}
+
+func (l *landscape) classes() []string {
+	c := make([]string, 0, len(l.bases))
+	for k := range l.bases {
+		c = append(c, k)
+	}
+	sort.Strings(c)
+	return c
+}
+
+// writeTSV writes the landscape to w. Fractions of the genome are given
+// if genome is not zero.
+func (l *landscape) writeTSV(w io.Writer, genome int) error {
+	_, err := fmt.Fprintln(w, "class\tbin_start\tbin_end\tbases\tfraction")
+	if err != nil {
+		return err
+	}
+	for _, c := range l.classes() {
+		for i, n := range l.bases[c] {
+			fraction := "."
+			if genome != 0 {
+				fraction = fmt.Sprintf("%.4g", float64(n)/float64(genome))
+			}
+			_, err = fmt.Fprintf(w, "%s\t%g\t%g\t%d\t%s\n",
+				c, float64(i)*l.width, float64(i+1)*l.width, n, fraction)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Plot dimensions.
+const (
+	plotWidth   = 700
+	plotHeight  = 300
+	plotMargin  = 60
+	legendWidth = 160
+	legendLine  = 14
+)
+
+// writeSVG writes the landscape to w as a stacked bar chart with a bar
+// for each divergence bin. Bars are scaled to the fraction of the genome
+// if genome is not zero, and to bases otherwise.
+func (l *landscape) writeSVG(w io.Writer, genome int) error {
+	classes := l.classes()
+	totals := make([]int, l.bins)
+	max := 0
+	for _, c := range classes {
+		for i, n := range l.bases[c] {
+			totals[i] += n
+			if totals[i] > max {
+				max = totals[i]
+			}
+		}
+	}
+	unit := "bases"
+	top := float64(max)
+	if genome != 0 {
+		unit = "fraction of genome"
+		top /= float64(genome)
+	}
+
+	height := plotHeight + 2*plotMargin
+	if h := len(classes)*legendLine + 2*plotMargin; h > height {
+		height = h
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="10">
+<rect x="%d" y="%d" width="%d" height="%d" fill="none" stroke="black"/>
+<text x="%d" y="%d" text-anchor="middle">divergence (%%)</text>
+<text x="%d" y="%d" text-anchor="end">0</text>
+<text x="%d" y="%d" text-anchor="end">%.4g</text>
+<text x="%d" y="%d">%s</text>
+`, plotWidth+2*plotMargin+legendWidth, height,
+		plotMargin, plotMargin, plotWidth, plotHeight,
+		plotMargin+plotWidth/2, plotMargin+plotHeight+28,
+		plotMargin-3, plotMargin+plotHeight,
+		plotMargin-3, plotMargin+10, top,
+		plotMargin, plotMargin-10, unit,
+	)
+	bw := float64(plotWidth) / float64(l.bins)
+	for i := 0; i <= l.bins; i += ticks(l.bins) {
+		fmt.Fprintf(&buf, `<text x="%.2f" y="%d" text-anchor="middle">%g</text>
+`, float64(plotMargin)+float64(i)*bw, plotMargin+plotHeight+12, float64(i)*l.width)
+	}
+	if max != 0 {
+		base := make([]float64, l.bins)
+		for k, c := range classes {
+			for i, n := range l.bases[c] {
+				if n == 0 {
+					continue
+				}
+				h := float64(plotHeight) * float64(n) / float64(max)
+				base[i] += h
+				fmt.Fprintf(&buf, `<rect x="%.2f" y="%.2f" width="%.2f" height="%.2f" fill="rgb(%s)" stroke="white" stroke-width="0.5"><title>%s %g-%g%%: %d</title></rect>
+`, float64(plotMargin)+float64(i)*bw, float64(plotMargin+plotHeight)-base[i], bw, h, color(k),
+					html.EscapeString(c), float64(i)*l.width, float64(i+1)*l.width, n)
+			}
+		}
+	}
+	for i, c := range classes {
+		y := plotMargin + i*legendLine
+		fmt.Fprintf(&buf, `<rect x="%d" y="%d" width="10" height="10" fill="rgb(%s)"/>
+<text x="%d" y="%d">%s</text>
+`, plotWidth+plotMargin+10, y, color(i), plotWidth+plotMargin+25, y+9, html.EscapeString(c))
+	}
+	buf.WriteString("</svg>\n")
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// palette is the set of colours used for the first classes of a plot.
+var palette = []string{
+	"31,119,180", "255,127,14", "44,160,44", "214,39,40", "148,103,189",
+	"140,86,75", "227,119,194", "127,127,127", "188,189,34", "23,190,207",
+	"174,199,232", "255,187,120", "152,223,138", "255,152,150", "197,176,213",
+	"196,156,148", "247,182,210", "199,199,199", "219,219,141", "158,218,229",
+}
+
+// color returns the RGB value of the ith class of a plot. Classes beyond
+// the palette are given hues spaced by the golden angle.
+func color(i int) string {
+	if i < len(palette) {
+		return palette[i]
+	}
+	h := math.Mod(float64(i-len(palette))*137.508, 360) / 60
+	x := 1 - math.Abs(math.Mod(h, 2)-1)
+	var r, g, b float64
+	switch int(h) {
+	case 0:
+		r, g = 1, x
+	case 1:
+		r, g = x, 1
+	case 2:
+		g, b = 1, x
+	case 3:
+		g, b = x, 1
+	case 4:
+		r, b = x, 1
+	default:
+		r, b = 1, x
+	}
+	// Scale to a mid saturation and value.
+	const lo, hi = 60, 200
+	return fmt.Sprintf("%.0f,%.0f,%.0f", lo+r*(hi-lo), lo+g*(hi-lo), lo+b*(hi-lo))
+}
+
+// ticks returns the number of bins between axis labels for n bins.
+func ticks(n int) int {
+	t := n / 10
+	if t < 1 {
+		t = 1
+	}
+	return t
+}
@@ -0,0 +1,410 @@
+// Copyright ©2015 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// mask masks a genome using quilt repeat annotation.
+//
+// Repeat features are read from the GFF files named on the command line, or
+// from stdin if no files are given. Files may be any mix of rm2gff, tailor,
+// stitch or patchwork output. Features with a Parts attribute are treated as
+// composites and features with a Repeat attribute are treated as simple
+// repeats. Other features are ignored. The masked genome is written to stdout
+// as fasta. Composites are masked over the genomic intervals of their parts, so
+// insertions between parts are not masked by the composite.
+//
+// With -mask soft, masked bases are written in lower case and, unless -clear
+// is false, all other bases are written in upper case so that existing soft
+// masking is removed. With -mask hard, masked bases are replaced with N.
+//
+// Features may be filtered before masking:
+//
+//	-type:         mask only composite or only simple repeats
+//	-class:        comma separated list of classes to mask; a class matches
+//	               itself and all its subclasses, so LTR matches LTR/ERV1
+//	-name:         comma separated list of repeat names to mask; a composite
+//	               matches if any of its parts match
+//	-min-coverage: minimum fraction of the consensus covered by the feature
+//
+// The consensus coverage of a simple repeat is taken from its Repeat
+// attribute. The consensus coverage of a composite is the union of the
+// consensus intervals of its parts as a fraction of the consensus length.
+// Consensus lengths are taken from the Repeat attributes of simple features in
+// the input and from the file given by -lengths, which holds one repeat name
+// and consensus length per line, separated by a tab. Composites with no known
+// consensus length do not pass a -min-coverage filter.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/biogo/biogo/alphabet"
+	"github.com/biogo/biogo/feat"
+	"github.com/biogo/biogo/io/featio/gff"
+	"github.com/biogo/biogo/io/seqio"
+	"github.com/biogo/biogo/io/seqio/fasta"
+	"github.com/biogo/biogo/seq/linear"
+
+	"github.com/kortschak/quilt/chain"
+	"github.com/kortschak/quilt/genome"
+)
+
+var (
+	genomeFile  = flag.String("genome", "", "Filename for genome fasta.")
+	maskType    = flag.String("mask", "soft", "Masking to apply: soft or hard.")
+	clearMask   = flag.Bool("clear", true, "Clear existing soft masking before soft masking.")
+	kind        = flag.String("type", "all", "Features to mask: all, composite or simple.")
+	classes     = flag.String("class", "", "Comma separated list of repeat classes to mask (default all).")
+	names       = flag.String("name", "", "Comma separated list of repeat names to mask (default all).")
+	minCoverage = flag.Float64("min-coverage", 0, "Minimum fraction of consensus covered by a masked feature.")
+	lengthsFile = flag.String("lengths", "", "Filename for tab separated consensus lengths.")
+	help        = flag.Bool("help", false, "Print this usage message.")
+)
+
+func main() {
+	flag.Parse()
+	if *help || *genomeFile == "" {
+		flag.Usage()
+		os.Exit(0)
+	}
+	switch *maskType {
+	case "soft", "hard":
+	default:
+		log.Fatalf("unknown mask type: %q", *maskType)
+	}
+	switch *kind {
+	case "all", "composite", "simple":
+	default:
+		log.Fatalf("unknown feature type: %q", *kind)
+	}
+
+	var features []repeat
+	lengths := make(map[string]int)
+	if *lengthsFile != "" {
+		var err error
+		lengths, err = genome.ReadLengths(*lengthsFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if len(flag.Args()) == 0 {
+		var err error
+		features, err = readFeatures(os.Stdin, features, lengths)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	for _, file := range flag.Args() {
+		f, err := os.Open(file)
+		if err != nil {
+			log.Fatalf("could not open %q: %v", file, err)
+		}
+		fmt.Fprintf(os.Stderr, "reading repeat features from %q\n", file)
+		features, err = readFeatures(f, features, lengths)
+		f.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	s := selector{
+		kind:        *kind,
+		classes:     list(*classes),
+		names:       list(*names),
+		minCoverage: *minCoverage,
+		lengths:     lengths,
+	}
+	regions := make(map[string][]region)
+	var n, unknown int
+	for _, r := range features {
+		ok, known := s.selects(r)
+		if !known {
+			unknown++
+		}
+		if !ok {
+			continue
+		}
+		regions[r.SeqName] = append(regions[r.SeqName], r.blocks...)
+		n++
+	}
+	if unknown != 0 {
+		log.Printf("%d composites with unknown consensus length not masked", unknown)
+	}
+	fmt.Fprintf(os.Stderr, "masking %d of %d features\n", n, len(features))
+
+	g, err := os.Open(*genomeFile)
+	if err != nil {
+		log.Fatalf("could not open %q: %v", *genomeFile, err)
+	}
+	defer g.Close()
+	fmt.Fprintf(os.Stderr, "reading genome from %q\n", *genomeFile)
+
+	w := fasta.NewWriter(os.Stdout, 60)
+	sc := seqio.NewScanner(fasta.NewReader(g, linear.NewSeq("", nil, alphabet.DNA)))
+	for sc.Next() {
+		chrom := sc.Seq().(*linear.Seq)
+		if *maskType == "soft" && *clearMask {
+			upper(chrom.Seq)
+		}
+		for _, r := range regions[chrom.Name()] {
+			if r.end > chrom.Len() {
+				log.Fatalf("feature extends beyond end of %s: %d-%d", chrom.Name(), feat.ZeroToOne(r.start), r.end)
+			}
+			switch *maskType {
+			case "soft":
+				lower(chrom.Seq[r.start:r.end])
+			case "hard":
+				for i := range chrom.Seq[r.start:r.end] {
+					chrom.Seq[r.start+i] = 'N'
+				}
+			}
+		}
+		delete(regions, chrom.Name())
+		_, err := w.Write(chrom)
+		if err != nil {
+			log.Fatalf("failed to write sequence: %v", err)
+		}
+	}
+	if sc.Error() != nil {
+		log.Fatalf("failed during genome read: %v", sc.Error())
+	}
+	for chr, r := range regions {
+		log.Printf("no sequence for %s: %d features not masked", chr, len(r))
+	}
+}
+
+// region is a half-open genomic interval to be masked.
+type region struct {
+	start, end int
+}
+
+// repeat is a simple or composite repeat feature.
+type repeat struct {
+	*gff.Feature
+
+	composite bool
+	class     string
+	parts     []part
+
+	// blocks are the genomic intervals
+	// covered by the repeat.
+	blocks []region
+
+	// consensus is the consensus length of a
+	// simple repeat and zero for composites.
+	consensus int
+}
+
+// part is the consensus interval of a repeat or composite part.
+// left is zero-based and right is the end of the interval.
+type part struct {
+	name        string
+	left, right int
+}
+
+// readFeatures appends the repeat features read from r to dst, recording the
+// consensus lengths of simple repeats in lengths.
+func readFeatures(r io.Reader, dst []repeat, lengths map[string]int) ([]repeat, error) {
+	in := gff.NewReader(r)
+	for {
+		f, err := in.Read()
+		if err != nil {
+			if err != io.EOF {
+				return dst, fmt.Errorf("failed to read source feature: %v", err)
+			}
+			break
+		}
+		gf := f.(*gff.Feature)
+		var rep repeat
+		switch {
+		case gf.FeatAttributes.Get("Parts") != "":
+			rep, err = newComposite(gf)
+		case gf.FeatAttributes.Get("Repeat") != "":
+			rep, err = newSimple(gf)
+			if err == nil && rep.consensus > lengths[rep.parts[0].name] {
+				lengths[rep.parts[0].name] = rep.consensus
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return dst, err
+		}
+		dst = append(dst, rep)
+	}
+	return dst, nil
+}
+
+func newSimple(f *gff.Feature) (repeat, error) {
+	r := repeat{Feature: f}
+	fields := strings.Fields(f.FeatAttributes.Get("Repeat"))
+	if len(fields) != 5 {
+		return r, fmt.Errorf("bad repeat attribute: %v", f)
+	}
+	r.class = fields[1]
+	left, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return r, fmt.Errorf("failed to parse repeat left: %v", err)
+	}
+	right, err := strconv.Atoi(fields[3])
+	if err != nil {
+		return r, fmt.Errorf("failed to parse repeat right: %v", err)
+	}
+	remains, err := strconv.Atoi(fields[4])
+	if err != nil {
+		return r, fmt.Errorf("failed to parse repeat remains: %v", err)
+	}
+	r.parts = []part{{name: fields[0], left: feat.OneToZero(left), right: right}}
+	r.blocks = []region{{start: f.FeatStart, end: f.FeatEnd}}
+	r.consensus = right + remains
+	return r, nil
+}
+
+func newComposite(f *gff.Feature) (repeat, error) {
+	r := repeat{Feature: f, composite: true}
+
+	var err error
+	r.class, err = strconv.Unquote(f.FeatAttributes.Get("Class"))
+	if err != nil {
+		return r, fmt.Errorf("failed to unquote class: %v", err)
+	}
+	parts, err := chain.ParseParts(f.FeatAttributes.Get("Parts"), f.SeqName, f.FeatStrand)
+	if err != nil {
+		return r, fmt.Errorf("%v: %v", err, f)
+	}
+	for _, p := range parts {
+		r.parts = append(r.parts, part{name: p.Name, left: p.Left, right: p.Right})
+		r.blocks = append(r.blocks, region{start: p.Genomic.Left, end: p.Genomic.Right})
+	}
+	return r, nil
+}
+
+// selector filters repeats for masking.
+type selector struct {
+	kind        string
+	classes     []string
+	names       []string
+	minCoverage float64
+	lengths     map[string]int
+}
+
+// selects returns whether r passes the filters of s. If the
+// consensus length of a composite is required but not known,
+// known is false.
+func (s selector) selects(r repeat) (ok, known bool) {
+	switch s.kind {
+	case "composite":
+		if !r.composite {
+			return false, true
+		}
+	case "simple":
+		if r.composite {
+			return false, true
+		}
+	}
+	if s.classes != nil && !hasClass(r.class, s.classes) {
+		return false, true
+	}
+	if s.names != nil && !hasName(r.parts, s.names) {
+		return false, true
+	}
+	if s.minCoverage <= 0 {
+		return true, true
+	}
+	cov, known := s.coverage(r)
+	return known && cov >= s.minCoverage, known
+}
+
+// coverage returns the fraction of the consensus of r covered by its parts.
+func (s selector) coverage(r repeat) (cov float64, known bool) {
+	length := r.consensus
+	if r.composite {
+		for _, p := range r.parts {
+			if s.lengths[p.name] > length {
+				length = s.lengths[p.name]
+			}
+		}
+	}
+	if length == 0 {
+		return 0, false
+	}
+
+	p := make([]part, len(r.parts))
+	copy(p, r.parts)
+	sort.Sort(byLeft(p))
+	var covered int
+	end := 0
+	for _, e := range p {
+		if e.left < end {
+			e.left = end
+		}
+		if e.right > e.left {
+			covered += e.right - e.left
+		}
+		if e.right > end {
+			end = e.right
+		}
+	}
+	return float64(covered) / float64(length), true
+}
+
+func hasClass(class string, classes []string) bool {
+	for _, c := range classes {
+		if class == c || strings.HasPrefix(class, c+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func hasName(parts []part, names []string) bool {
+	for _, p := range parts {
+		for _, n := range names {
+			if p.name == n {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// list returns the non-empty comma separated elements of s, or nil
+// if there are none.
+func list(s string) []string {
+	var l []string
+	for _, e := range strings.Split(s, ",") {
+		e = strings.TrimSpace(e)
+		if e != "" {
+			l = append(l, e)
+		}
+	}
+	return l
+}
+
+func upper(s alphabet.Letters) {
+	for i, l := range s {
+		if 'a' <= l && l <= 'z' {
+			s[i] = l &^ ('a' - 'A')
+		}
+	}
+}
+
+func lower(s alphabet.Letters) {
+	for i, l := range s {
+		if 'A' <= l && l <= 'Z' {
+			s[i] = l | ('a' - 'A')
+		}
+	}
+}
+
+type byLeft []part
+
+func (p byLeft) Len() int           { return len(p) }
+func (p byLeft) Less(i, j int) bool { return p[i].left < p[j].left }
+func (p byLeft) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
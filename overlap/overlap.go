@@ -0,0 +1,146 @@
+// Copyright ©2015 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package overlap provides overlap queries of genomic features against a set
+// of reference features.
+//
+// Two query engines are provided. Tree holds all the reference features in
+// per-sequence interval trees and accepts queries in any order. Sweep reads the
+// reference features from a coordinate-sorted stream and answers queries that
+// are presented in the same order, holding only the reference features in the
+// active window of the sweep line.
+//
+// Features are sorted when they are ordered by sequence name and then by start
+// position, which is the order that stitch writes composites.
+package overlap
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/biogo/biogo/feat"
+	"github.com/biogo/biogo/io/featio/gff"
+)
+
+// ErrUnsorted is returned when a sorted stream or query order is violated.
+var ErrUnsorted = errors.New("overlap: features not sorted")
+
+// Finder finds reference features overlapping query features.
+type Finder interface {
+	// Find calls fn for each reference feature
+	// that overlaps q.
+	Find(q feat.Feature, fn func(ref feat.Feature)) error
+}
+
+// Stream is a source of features. A Stream returns io.EOF when it has
+// no more features.
+type Stream func() (feat.Feature, error)
+
+// GFFStream returns a Stream of the features read by r.
+func GFFStream(r *gff.Reader) Stream {
+	return func() (feat.Feature, error) {
+		return r.Read()
+	}
+}
+
+// Less returns whether a is before b in sorted order.
+func Less(a, b feat.Feature) bool {
+	aName := a.Location().Name()
+	bName := b.Location().Name()
+	return aName < bName || (aName == bName && a.Start() < b.Start())
+}
+
+// SortedGFF returns whether the features in the named GFF file are sorted.
+func SortedGFF(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	r := gff.NewReader(f)
+	var last feat.Feature
+	for {
+		f, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				return true, nil
+			}
+			return false, err
+		}
+		if last != nil && Less(f, last) {
+			return false, nil
+		}
+		last = f
+	}
+}
+
+// UseSweep returns whether the named overlap engine uses a Sweep for the
+// GFF files at the given paths. The tree engine never uses a Sweep and the
+// sweep engine always does. The auto engine uses a Sweep only when all of
+// the files are sorted, and falls back to a Tree otherwise.
+func UseSweep(engine string, paths ...string) (bool, error) {
+	switch engine {
+	case "tree":
+		return false, nil
+	case "sweep":
+		return true, nil
+	case "auto":
+		for _, p := range paths {
+			ok, err := SortedGFF(p)
+			if err != nil {
+				return false, fmt.Errorf("failed to check order of %q: %v", p, err)
+			}
+			if !ok {
+				return false, nil
+			}
+		}
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown overlap engine: %q", engine)
+	}
+}
+
+// Merge returns a sorted Stream of the features of the given sorted
+// streams. If any of the streams is not sorted, the returned Stream
+// returns ErrUnsorted.
+func Merge(streams ...Stream) Stream {
+	heads := make([]feat.Feature, len(streams))
+	for i, s := range streams {
+		f, err := s()
+		if err != nil {
+			if err == io.EOF {
+				continue
+			}
+			return func() (feat.Feature, error) { return nil, err }
+		}
+		heads[i] = f
+	}
+	return func() (feat.Feature, error) {
+		min := -1
+		for i, f := range heads {
+			if f != nil && (min < 0 || Less(f, heads[min])) {
+				min = i
+			}
+		}
+		if min < 0 {
+			return nil, io.EOF
+		}
+		f := heads[min]
+		next, err := streams[min]()
+		switch {
+		case err == io.EOF:
+			heads[min] = nil
+		case err != nil:
+			return nil, err
+		case Less(next, f):
+			return nil, ErrUnsorted
+		default:
+			heads[min] = next
+		}
+		return f, nil
+	}
+}
@@ -0,0 +1,330 @@
+// Copyright ©2015 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package overlap
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/biogo/biogo/feat"
+	"github.com/biogo/biogo/io/featio/gff"
+)
+
+// The default benchmark data approximates the composite and repeat
+// feature density of a mammalian genome.
+var (
+	chroms     = flag.Int("chroms", 24, "number of chromosomes in benchmark data")
+	chromLen   = flag.Int("chrom-len", 125e6, "length of chromosomes in benchmark data")
+	references = flag.Int("refs", 2e5, "number of reference features in benchmark data")
+	queries    = flag.Int("queries", 5e6, "number of query features in benchmark data")
+)
+
+var benchRefs, benchQueries []feat.Feature
+
+func benchData() ([]feat.Feature, []feat.Feature) {
+	if benchRefs == nil {
+		rnd := rand.New(rand.NewSource(1))
+		benchRefs = features(rnd, *references, *chroms, *chromLen, 500, 20000)
+		benchQueries = features(rnd, *queries, *chroms, *chromLen, 20, 6000)
+	}
+	return benchRefs, benchQueries
+}
+
+// features returns n sorted random features on the given number of
+// chromosomes of length chromLen with lengths between min and max.
+func features(rnd *rand.Rand, n, chroms, chromLen, min, max int) []feat.Feature {
+	f := make([]feat.Feature, n)
+	for i := range f {
+		start := rnd.Intn(chromLen - max)
+		f[i] = &gff.Feature{
+			SeqName:   fmt.Sprintf("chr%d", rnd.Intn(chroms)+1),
+			FeatStart: start,
+			FeatEnd:   start + min + rnd.Intn(max-min),
+		}
+	}
+	sort.Sort(byLocation(f))
+	return f
+}
+
+type byLocation []feat.Feature
+
+func (f byLocation) Len() int           { return len(f) }
+func (f byLocation) Less(i, j int) bool { return Less(f[i], f[j]) }
+func (f byLocation) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+
+func sliceStream(f []feat.Feature) Stream {
+	return func() (feat.Feature, error) {
+		if len(f) == 0 {
+			return nil, io.EOF
+		}
+		next := f[0]
+		f = f[1:]
+		return next, nil
+	}
+}
+
+func feature(chrom string, start, end int) feat.Feature {
+	return &gff.Feature{SeqName: chrom, FeatStart: start, FeatEnd: end}
+}
+
+func TestSweepMatchesTree(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	refs := features(rnd, 2000, 3, 1e5, 20, 6000)
+	queries := features(rnd, 5000, 4, 1e5, 20, 600)
+
+	tree := NewTree()
+	for _, r := range refs {
+		tree.Insert(r)
+	}
+	var retired []feat.Feature
+	retiredAt := make(map[feat.Feature]int)
+	sweep := NewSweep(sliceStream(refs))
+	sweep.Retire = func(f feat.Feature) {
+		retired = append(retired, f)
+		retiredAt[f] = len(retired)
+	}
+
+	for i, q := range queries {
+		want := make(map[feat.Feature]bool)
+		tree.Find(q, func(f feat.Feature) { want[f] = true })
+		got := make(map[feat.Feature]bool)
+		err := sweep.Find(q, func(f feat.Feature) {
+			if got[f] {
+				t.Errorf("query %d: duplicate hit %v", i, f)
+			}
+			got[f] = true
+		})
+		if err != nil {
+			t.Fatalf("unexpected error for query %d: %v", i, err)
+		}
+		if len(got) != len(want) {
+			t.Errorf("query %d: unexpected number of hits: got:%d want:%d", i, len(got), len(want))
+		}
+		for f := range got {
+			if !want[f] {
+				t.Errorf("query %d: unexpected hit %v", i, f)
+			}
+			if _, ok := retiredAt[f]; ok {
+				t.Errorf("query %d: hit %v already retired", i, f)
+			}
+		}
+	}
+	err := sweep.Close()
+	if err != nil {
+		t.Fatalf("unexpected error closing sweep: %v", err)
+	}
+
+	if len(retired) != len(refs) {
+		t.Fatalf("unexpected number of retired features: got:%d want:%d", len(retired), len(refs))
+	}
+	for i, f := range retired {
+		if f != refs[i] {
+			t.Errorf("feature %d retired out of order", i)
+		}
+	}
+}
+
+func TestSweepDropsPassed(t *testing.T) {
+	refs := []feat.Feature{
+		feature("chr1", 0, 1000),
+		feature("chr1", 10, 20),
+		feature("chr1", 30, 40),
+		feature("chr1", 600, 700),
+	}
+	var retired []feat.Feature
+	s := NewSweep(sliceStream(refs))
+	s.Retire = func(f feat.Feature) { retired = append(retired, f) }
+
+	var hits []feat.Feature
+	err := s.Find(feature("chr1", 500, 650), func(f feat.Feature) { hits = append(hits, f) })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(hits) != 2 || hits[0] != refs[0] || hits[1] != refs[3] {
+		t.Errorf("unexpected hits: got:%v want:%v", hits, []feat.Feature{refs[0], refs[3]})
+	}
+	if len(s.active) != 2 {
+		t.Errorf("unexpected number of active features: got:%d want:2", len(s.active))
+	}
+	if len(retired) != 0 {
+		t.Errorf("unexpected retirement before earlier features: %v", retired)
+	}
+
+	err = s.Find(feature("chr1", 1000, 1100), func(feat.Feature) {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(s.active) != 0 {
+		t.Errorf("unexpected number of active features: got:%d want:0", len(s.active))
+	}
+	if len(retired) != len(refs) {
+		t.Fatalf("unexpected number of retired features: got:%d want:%d", len(retired), len(refs))
+	}
+	for i, f := range retired {
+		if f != refs[i] {
+			t.Errorf("feature %d retired out of order", i)
+		}
+	}
+}
+
+func TestSweepClose(t *testing.T) {
+	refs := []feat.Feature{
+		feature("chr1", 0, 100),
+		feature("chr1", 50, 150),
+		feature("chr2", 0, 100),
+		feature("chr3", 0, 100),
+		feature("chr3", 500, 600),
+	}
+	var retired []feat.Feature
+	s := NewSweep(sliceStream(refs))
+	s.Retire = func(f feat.Feature) { retired = append(retired, f) }
+	for _, q := range []feat.Feature{
+		feature("chr1", 60, 70),
+		feature("chr3", 10, 20),
+	} {
+		err := s.Find(q, func(feat.Feature) {})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if len(retired) != 3 {
+		t.Errorf("unexpected number of retired features before close: got:%d want:3", len(retired))
+	}
+	err := s.Close()
+	if err != nil {
+		t.Fatalf("unexpected error closing sweep: %v", err)
+	}
+	if len(retired) != len(refs) {
+		t.Fatalf("unexpected number of retired features: got:%d want:%d", len(retired), len(refs))
+	}
+	for i, f := range retired {
+		if f != refs[i] {
+			t.Errorf("feature %d retired out of order", i)
+		}
+	}
+}
+
+func TestSweepUnsorted(t *testing.T) {
+	refs := []feat.Feature{
+		feature("chr1", 0, 100),
+		feature("chr1", 500, 600),
+		feature("chr1", 200, 300),
+	}
+	s := NewSweep(sliceStream(refs))
+	err := s.Find(feature("chr1", 50, 60), func(feat.Feature) {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = s.Find(feature("chr1", 10, 20), func(feat.Feature) {})
+	if err != ErrUnsorted {
+		t.Errorf("unexpected error for unsorted query: got:%v want:%v", err, ErrUnsorted)
+	}
+	err = s.Find(feature("chr1", 550, 560), func(feat.Feature) {})
+	if err != ErrUnsorted {
+		t.Errorf("unexpected error for unsorted references: got:%v want:%v", err, ErrUnsorted)
+	}
+	err = s.Close()
+	if err != ErrUnsorted {
+		t.Errorf("unexpected error closing sweep: got:%v want:%v", err, ErrUnsorted)
+	}
+
+	merged := Merge(sliceStream(refs))
+	for {
+		_, err = merged()
+		if err != nil {
+			break
+		}
+	}
+	if err != ErrUnsorted {
+		t.Errorf("unexpected error for unsorted merge: got:%v want:%v", err, ErrUnsorted)
+	}
+}
+
+func TestUseSweep(t *testing.T) {
+	dir := t.TempDir()
+	sorted := filepath.Join(dir, "sorted.gff")
+	unsorted := filepath.Join(dir, "unsorted.gff")
+	for _, f := range []struct {
+		path, data string
+	}{
+		{path: sorted, data: "chr1\tstitch\tcomposite\t1\t100\t.\t+\t.\nchr1\tstitch\tcomposite\t50\t150\t.\t+\t.\nchr2\tstitch\tcomposite\t1\t100\t.\t+\t.\n"},
+		{path: unsorted, data: "chr2\tstitch\tcomposite\t1\t100\t.\t+\t.\nchr1\tstitch\tcomposite\t1\t100\t.\t+\t.\n"},
+	} {
+		err := os.WriteFile(f.path, []byte(f.data), 0o644)
+		if err != nil {
+			t.Fatalf("failed to write test data: %v", err)
+		}
+	}
+
+	for _, test := range []struct {
+		engine string
+		paths  []string
+		want   bool
+	}{
+		{engine: "tree", paths: []string{sorted}, want: false},
+		{engine: "sweep", paths: []string{unsorted}, want: true},
+		{engine: "auto", paths: []string{sorted}, want: true},
+		{engine: "auto", paths: []string{unsorted}, want: false},
+		{engine: "auto", paths: []string{sorted, unsorted}, want: false},
+	} {
+		got, err := UseSweep(test.engine, test.paths...)
+		if err != nil {
+			t.Errorf("unexpected error for %s engine with %v: %v", test.engine, test.paths, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("unexpected result for %s engine with %v: got:%t want:%t", test.engine, test.paths, got, test.want)
+		}
+	}
+
+	_, err := UseSweep("auto", filepath.Join(dir, "missing.gff"))
+	if err == nil {
+		t.Error("expected error for missing file")
+	}
+	_, err = UseSweep("heap", sorted)
+	if err == nil {
+		t.Error("expected error for unknown engine")
+	}
+}
+
+var sink int
+
+func BenchmarkTree(b *testing.B) {
+	refs, queries := benchData()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		t := NewTree()
+		for _, r := range refs {
+			t.Insert(r)
+		}
+		for _, q := range queries {
+			t.Find(q, func(feat.Feature) { sink++ })
+		}
+	}
+}
+
+func BenchmarkSweep(b *testing.B) {
+	refs, queries := benchData()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s := NewSweep(sliceStream(refs))
+		for _, q := range queries {
+			err := s.Find(q, func(feat.Feature) { sink++ })
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+		err := s.Close()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
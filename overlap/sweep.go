@@ -0,0 +1,173 @@
+// Copyright ©2015 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package overlap
+
+import (
+	"io"
+
+	"github.com/biogo/biogo/feat"
+)
+
+// Sweep is a Finder that reads reference features from a sorted Stream
+// as a sweep line advances with each query. Queries to a Sweep must be
+// made in sorted order. Only the reference features that may overlap
+// the current or a later query are held.
+type Sweep struct {
+	refs Stream
+
+	// Retire is called with each reference feature,
+	// in stream order, when no later query can
+	// overlap it. Retire may be nil.
+	Retire func(ref feat.Feature)
+
+	chrom string
+
+	// active holds the reference features that may
+	// overlap the current or a later query and queue
+	// holds the features awaiting retirement in stream
+	// order.
+	active []*swept
+	queue  []*swept
+
+	pending feat.Feature
+	last    feat.Feature
+	query   feat.Feature
+	eof     bool
+	err     error
+}
+
+// swept is a reference feature read by a Sweep.
+type swept struct {
+	feat.Feature
+
+	// done indicates that no later query
+	// can overlap the feature.
+	done bool
+}
+
+// NewSweep returns a new Sweep reading sorted reference features from refs.
+func NewSweep(refs Stream) *Sweep {
+	return &Sweep{refs: refs}
+}
+
+// next returns the next reference feature without consuming it.
+func (s *Sweep) next() feat.Feature {
+	if s.pending != nil || s.eof || s.err != nil {
+		return s.pending
+	}
+	f, err := s.refs()
+	if err != nil {
+		if err == io.EOF {
+			s.eof = true
+		} else {
+			s.err = err
+		}
+		return nil
+	}
+	if s.last != nil && Less(f, s.last) {
+		s.err = ErrUnsorted
+		return nil
+	}
+	s.last = f
+	s.pending = f
+	return f
+}
+
+func (s *Sweep) retire(f feat.Feature) {
+	if s.Retire != nil {
+		s.Retire(f)
+	}
+}
+
+// flush retires the features at the head of the retirement queue that
+// are done, or all the queued features if all is true.
+func (s *Sweep) flush(all bool) {
+	var n int
+	for _, f := range s.queue {
+		if !all && !f.done {
+			break
+		}
+		s.retire(f.Feature)
+		n++
+	}
+	s.queue = s.queue[:copy(s.queue, s.queue[n:])]
+	if all {
+		s.active = s.active[:0]
+	}
+}
+
+// Find calls fn for each reference feature that overlaps q. Find returns
+// ErrUnsorted if q is before the previous query or if the reference stream
+// is not sorted, and returns any error returned by the reference stream.
+func (s *Sweep) Find(q feat.Feature, fn func(ref feat.Feature)) error {
+	if s.err != nil {
+		return s.err
+	}
+	if s.query != nil && Less(q, s.query) {
+		return ErrUnsorted
+	}
+	s.query = q
+
+	chrom := q.Location().Name()
+	if chrom != s.chrom {
+		s.flush(true)
+		s.chrom = chrom
+	}
+
+	// Advance the sweep line to the end of q.
+	for f := s.next(); f != nil; f = s.next() {
+		name := f.Location().Name()
+		if name > chrom || (name == chrom && f.Start() >= q.End()) {
+			break
+		}
+		if name < chrom {
+			s.retire(f)
+		} else {
+			a := &swept{Feature: f}
+			s.active = append(s.active, a)
+			s.queue = append(s.queue, a)
+		}
+		s.pending = nil
+	}
+	if s.err != nil {
+		return s.err
+	}
+
+	// Drop features left of the sweep line and retire those
+	// that are not held in the queue by an earlier feature.
+	active := s.active[:0]
+	for _, a := range s.active {
+		if a.End() <= q.Start() {
+			a.done = true
+			continue
+		}
+		active = append(active, a)
+	}
+	for i := len(active); i < len(s.active); i++ {
+		s.active[i] = nil
+	}
+	s.active = active
+	s.flush(false)
+
+	for _, a := range s.active {
+		if a.Start() < q.End() {
+			fn(a.Feature)
+		}
+	}
+	return nil
+}
+
+// Close retires all remaining reference features, reading the remainder
+// of the reference stream, and returns any error encountered by the Sweep.
+func (s *Sweep) Close() error {
+	s.flush(true)
+	s.active = nil
+	s.queue = nil
+	for f := s.next(); f != nil; f = s.next() {
+		s.retire(f)
+		s.pending = nil
+	}
+	return s.err
+}
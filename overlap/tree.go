@@ -0,0 +1,97 @@
+// Copyright ©2015 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package overlap
+
+import (
+	"sort"
+
+	"github.com/biogo/biogo/feat"
+	"github.com/biogo/store/interval"
+)
+
+// Tree is a Finder that holds reference features in interval trees.
+// Queries to a Tree may be made in any order.
+type Tree struct {
+	trees map[string]*interval.IntTree
+	dirty bool
+}
+
+// NewTree returns a new empty Tree.
+func NewTree() *Tree {
+	return &Tree{trees: make(map[string]*interval.IntTree)}
+}
+
+// Insert adds the reference feature f to the tree.
+func (t *Tree) Insert(f feat.Feature) {
+	chrom := f.Location().Name()
+	it, ok := t.trees[chrom]
+	if !ok {
+		it = &interval.IntTree{}
+		t.trees[chrom] = it
+	}
+	it.Insert(node{Feature: f, id: uintptr(it.Len())}, true)
+	t.dirty = true
+}
+
+func (t *Tree) adjust() {
+	if !t.dirty {
+		return
+	}
+	for _, it := range t.trees {
+		it.AdjustRanges()
+	}
+	t.dirty = false
+}
+
+// Find calls fn for each reference feature in the tree that overlaps q.
+// The returned error is always nil.
+func (t *Tree) Find(q feat.Feature, fn func(ref feat.Feature)) error {
+	t.adjust()
+	it, ok := t.trees[q.Location().Name()]
+	if !ok {
+		return nil
+	}
+	for _, m := range it.Get(query{q}) {
+		fn(m.(node).Feature)
+	}
+	return nil
+}
+
+// Do calls fn for each reference feature in the tree in sorted order.
+func (t *Tree) Do(fn func(ref feat.Feature)) {
+	t.adjust()
+	chroms := make([]string, 0, len(t.trees))
+	for chr := range t.trees {
+		chroms = append(chroms, chr)
+	}
+	sort.Strings(chroms)
+	for _, chr := range chroms {
+		t.trees[chr].Do(func(i interval.IntInterface) (done bool) {
+			fn(i.(node).Feature)
+			return
+		})
+	}
+}
+
+type node struct {
+	feat.Feature
+	id uintptr
+}
+
+// Overlap returns whether n overlaps b.
+func (n node) Overlap(b interval.IntRange) bool {
+	return n.End() > b.Start && n.Start() < b.End
+}
+func (n node) ID() uintptr              { return n.id }
+func (n node) Range() interval.IntRange { return interval.IntRange{Start: n.Start(), End: n.End()} }
+
+type query struct {
+	feat.Feature
+}
+
+// Overlap returns whether q overlaps b.
+func (q query) Overlap(b interval.IntRange) bool {
+	return q.End() > b.Start && q.Start() < b.End
+}
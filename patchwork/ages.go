@@ -0,0 +1,184 @@
+// Copyright ©2015 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// ages aggregates insertion relationships between repeat labels to infer
+// the relative ages of repeat activity. An inserted element is younger
+// than the element it interrupts.
+type ages struct {
+	// byName specifies that repeats are
+	// labelled by name rather than class.
+	byName bool
+
+	// counts holds the number of times
+	// the first label is inserted into
+	// the second.
+	counts map[[2]string]int
+
+	hosted   map[string]int
+	inserted map[string]int
+}
+
+func newAges(byName bool) *ages {
+	return &ages{
+		byName:   byName,
+		counts:   make(map[[2]string]int),
+		hosted:   make(map[string]int),
+		inserted: make(map[string]int),
+	}
+}
+
+// agesOf returns the insertion relationships of the elements in n. Each
+// element is counted only as inserted into its parent, the innermost
+// composite containing it, so an element nested within several composites
+// is not counted as inserted into the outer composites.
+func agesOf(n *nesting, byName bool) *ages {
+	a := newAges(byName)
+	for _, e := range n.elements {
+		if e.parent != nil {
+			a.add(e)
+		}
+	}
+	return a
+}
+
+func (a *ages) label(e *element) string {
+	if a.byName {
+		return e.name
+	}
+	return e.class
+}
+
+// add records the insertion of e into its parent.
+func (a *ages) add(e *element) {
+	h := a.label(e.parent)
+	i := a.label(e)
+	a.counts[[2]string{i, h}]++
+	a.hosted[h]++
+	a.inserted[i]++
+}
+
+// rank is the inferred relative age of a repeat label.
+type rank struct {
+	label string
+
+	// older and younger are the number of
+	// labels that the label is inferred to
+	// be older and younger than.
+	older, younger int
+
+	hosted, inserted int
+}
+
+func (r rank) score() int { return r.older - r.younger }
+
+func (r rank) hostFraction() float64 {
+	return float64(r.hosted) / float64(r.hosted+r.inserted)
+}
+
+// order returns the labels in inferred order of activity, oldest first.
+// For each pair of labels, the label more often inserted into the other
+// is inferred to be the younger. Labels are ranked by the number of labels
+// they are older than less the number they are younger than, with ties
+// broken by the fraction of their insertion relationships in which they
+// are the host.
+func (a *ages) order() []rank {
+	seen := make(map[string]*rank)
+	get := func(l string) *rank {
+		r, ok := seen[l]
+		if !ok {
+			r = &rank{label: l, hosted: a.hosted[l], inserted: a.inserted[l]}
+			seen[l] = r
+		}
+		return r
+	}
+	pairs := make(map[[2]string]bool)
+	for k := range a.counts {
+		get(k[0])
+		get(k[1])
+		if k[0] == k[1] {
+			continue
+		}
+		if k[0] > k[1] {
+			k[0], k[1] = k[1], k[0]
+		}
+		pairs[k] = true
+	}
+	for p := range pairs {
+		x, y := p[0], p[1]
+		xIntoY := a.counts[[2]string{x, y}]
+		yIntoX := a.counts[[2]string{y, x}]
+		switch {
+		case xIntoY > yIntoX:
+			get(x).younger++
+			get(y).older++
+		case yIntoX > xIntoY:
+			get(y).younger++
+			get(x).older++
+		}
+	}
+
+	ranks := make([]rank, 0, len(seen))
+	for _, r := range seen {
+		ranks = append(ranks, *r)
+	}
+	sort.Sort(byAge(ranks))
+	return ranks
+}
+
+type byAge []rank
+
+func (r byAge) Len() int { return len(r) }
+func (r byAge) Less(i, j int) bool {
+	si, sj := r[i].score(), r[j].score()
+	if si != sj {
+		return si > sj
+	}
+	fi, fj := r[i].hostFraction(), r[j].hostFraction()
+	if fi != fj {
+		return fi > fj
+	}
+	return r[i].label < r[j].label
+}
+func (r byAge) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+
+// writeMatrix writes the insertion count matrix to w as TSV with rows
+// giving the inserted label and columns giving the host label, both in
+// the order given by ranks.
+func (a *ages) writeMatrix(w io.Writer, ranks []rank) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprint(bw, "inserted\\host")
+	for _, h := range ranks {
+		fmt.Fprintf(bw, "\t%s", h.label)
+	}
+	bw.WriteByte('\n')
+	for _, i := range ranks {
+		fmt.Fprint(bw, i.label)
+		for _, h := range ranks {
+			fmt.Fprintf(bw, "\t%d", a.counts[[2]string{i.label, h.label}])
+		}
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// writeOrder writes the inferred order of activity to w as TSV.
+func writeOrder(w io.Writer, ranks []rank) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "rank\tlabel\tolder_than\tyounger_than\thosted\tinserted\thost_fraction")
+	for i, r := range ranks {
+		fmt.Fprintf(bw, "%d\t%s\t%d\t%d\t%d\t%d\t%.4f\n",
+			i+1, r.label, r.older, r.younger, r.hosted, r.inserted, r.hostFraction(),
+		)
+	}
+	return bw.Flush()
+}
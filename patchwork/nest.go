@@ -0,0 +1,239 @@
+// Copyright ©2015 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/biogo/biogo/feat"
+	"github.com/biogo/biogo/io/featio/gff"
+	"github.com/biogo/biogo/seq"
+
+	"github.com/kortschak/quilt/gff3"
+)
+
+// element is a node in a tree of nested insertions.
+type element struct {
+	*gff.Feature
+
+	name, class string
+
+	parent   *element
+	children []*element
+	depth    int
+}
+
+// isComposite returns whether e is a stitch composite.
+func (e *element) isComposite() bool {
+	return e.FeatAttributes.Get("Parts") != ""
+}
+
+// elementKey identifies an element independently of the
+// feature value it was read from.
+type elementKey struct {
+	chrom      string
+	start, end int
+	strand     seq.Strand
+	class      string
+}
+
+// nesting holds the insertion relationships between elements.
+type nesting struct {
+	elements map[elementKey]*element
+}
+
+func newNesting() *nesting {
+	return &nesting{elements: make(map[elementKey]*element)}
+}
+
+func (n *nesting) element(f *gff.Feature) *element {
+	name, class := identity(f)
+	k := elementKey{
+		chrom:  f.SeqName,
+		start:  f.FeatStart,
+		end:    f.FeatEnd,
+		strand: f.FeatStrand,
+		class:  class,
+	}
+	e, ok := n.elements[k]
+	if !ok {
+		e = &element{Feature: f, name: name, class: class}
+		n.elements[k] = e
+	}
+	return e
+}
+
+// add records that the features in inserted are inserted into host. An
+// inserted element is given the smallest host that it is inserted into
+// as its parent.
+func (n *nesting) add(host *gff.Feature, inserted []*gff.Feature) {
+	h := n.element(host)
+	// Prefer the host feature since it carries the insertions.
+	h.Feature = host
+	for _, f := range inserted {
+		e := n.element(f)
+		if e == h || e.Len() >= h.Len() {
+			continue
+		}
+		if e.parent == nil || h.Len() < e.parent.Len() {
+			e.parent = h
+		}
+	}
+}
+
+// roots returns the outermost elements that have insertions, with the
+// children and depths of all elements in their trees filled in.
+func (n *nesting) roots() []*element {
+	var roots []*element
+	for _, e := range n.elements {
+		if e.parent == nil {
+			roots = append(roots, e)
+			continue
+		}
+		e.parent.children = append(e.parent.children, e)
+	}
+	sort.Sort(byElementLocation(roots))
+	var setDepth func(e *element, depth int)
+	setDepth = func(e *element, depth int) {
+		e.depth = depth
+		sort.Sort(byElementLocation(e.children))
+		for _, c := range e.children {
+			setDepth(c, depth+1)
+		}
+	}
+	for _, r := range roots {
+		setDepth(r, 0)
+	}
+	return roots
+}
+
+// writeNestGFF3 writes the trees rooted at roots to w as GFF3 with the
+// tree structure given by Parent attributes.
+func writeNestGFF3(w io.Writer, roots []*element) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "##gff-version 3")
+	var (
+		id    int
+		write func(e *element, parent string)
+	)
+	write = func(e *element, parent string) {
+		id++
+		eid := fmt.Sprintf("nest%d", id)
+		typ := "repeat"
+		if e.isComposite() {
+			typ = "composite"
+		}
+		score := "."
+		if e.FeatScore != nil {
+			score = strconv.FormatFloat(*e.FeatScore, 'g', -1, 64)
+		}
+		fmt.Fprintf(bw, "%s\t%s\t%s\t%d\t%d\t%s\t%s\t.\tID=%s",
+			gff3.Escape(e.SeqName, false), gff3.Escape(e.Source, false), typ,
+			feat.ZeroToOne(e.FeatStart), e.FeatEnd, score, e.FeatStrand,
+			eid,
+		)
+		if parent != "" {
+			fmt.Fprintf(bw, ";Parent=%s", parent)
+		}
+		fmt.Fprintf(bw, ";Name=%s;Class=%s;Depth=%d\n",
+			gff3.Escape(e.name, true), gff3.Escape(e.class, true), e.depth,
+		)
+		for _, c := range e.children {
+			write(c, eid)
+		}
+	}
+	for _, r := range roots {
+		if len(r.children) != 0 {
+			write(r, "")
+		}
+	}
+	return bw.Flush()
+}
+
+// jsonElement is the JSON representation of an element and its children.
+type jsonElement struct {
+	Chrom    string         `json:"chrom"`
+	Start    int            `json:"start"`
+	End      int            `json:"end"`
+	Strand   string         `json:"strand"`
+	Source   string         `json:"source"`
+	Type     string         `json:"type"`
+	Name     string         `json:"name"`
+	Class    string         `json:"class"`
+	Depth    int            `json:"depth"`
+	Children []*jsonElement `json:"children,omitempty"`
+}
+
+// writeNestJSON writes the trees rooted at roots to w as a JSON array.
+// Start positions are one-based.
+func writeNestJSON(w io.Writer, roots []*element) error {
+	var conv func(e *element) *jsonElement
+	conv = func(e *element) *jsonElement {
+		typ := "repeat"
+		if e.isComposite() {
+			typ = "composite"
+		}
+		j := &jsonElement{
+			Chrom:  e.SeqName,
+			Start:  feat.ZeroToOne(e.FeatStart),
+			End:    e.FeatEnd,
+			Strand: e.FeatStrand.String(),
+			Source: e.Source,
+			Type:   typ,
+			Name:   e.name,
+			Class:  e.class,
+			Depth:  e.depth,
+		}
+		for _, c := range e.children {
+			j.Children = append(j.Children, conv(c))
+		}
+		return j
+	}
+	trees := []*jsonElement{}
+	for _, r := range roots {
+		if len(r.children) != 0 {
+			trees = append(trees, conv(r))
+		}
+	}
+	b, err := json.MarshalIndent(trees, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+// identity returns the repeat name and class of f. For composites the
+// name is the name of the first part.
+func identity(f *gff.Feature) (name, class string) {
+	if fields := strings.Fields(f.FeatAttributes.Get("Repeat")); len(fields) >= 2 {
+		return fields[0], fields[1]
+	}
+	class, _ = strconv.Unquote(f.FeatAttributes.Get("Class"))
+	if parts, err := strconv.Unquote(f.FeatAttributes.Get("Parts")); err == nil {
+		if fields := strings.Fields(parts); len(fields) != 0 {
+			name = fields[0]
+		}
+	}
+	return name, class
+}
+
+type byElementLocation []*element
+
+func (e byElementLocation) Len() int { return len(e) }
+func (e byElementLocation) Less(i, j int) bool {
+	iName := e[i].SeqName
+	jName := e[j].SeqName
+	return iName < jName ||
+		(iName == jName && e[i].FeatStart < e[j].FeatStart) ||
+		(iName == jName && e[i].FeatStart == e[j].FeatStart && e[i].FeatEnd > e[j].FeatEnd)
+}
+func (e byElementLocation) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
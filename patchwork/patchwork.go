@@ -4,6 +4,59 @@
 
 // patchwork overlays a set of repeats into stitch-chained composite repeats such
 // that the inserted repeats do not overlap the components of the chained repeats.
+//
+// Insertions are found using either an interval tree holding all composites or,
+// when the composite and repeat files are all sorted by sequence name and start,
+// a streaming sweep line over the merged repeat files that holds only the
+// composites near the current repeat. By default, the sweep line is used when
+// all inputs are sorted.
+//
+// If -nest is given, the full tree of nested insertions is written to the named
+// file. Inserted elements that are themselves composites may contain further
+// insertions, so an element is assigned the smallest composite it is inserted
+// into as its parent, and its depth is the number of composites it is nested
+// within. The tree is written as GFF3 with Parent and Depth attributes, or as
+// JSON with -nest-format json. For the tree to include nesting of composites
+// within composites, the composite file must also be given as a repeat file.
+//
+// If -ages is given, the insertions of all composites are aggregated into a matrix
+// of the number of times each repeat class, or name with -ages-by name, is inserted
+// into each other. Each element is counted only as inserted into its parent in the
+// nesting tree described above, so an element nested within several composites is
+// not also counted against the outer composites. Since an inserted element is
+// younger than the element it interrupts, the matrix is used to infer a relative
+// chronology of repeat activity. For each pair of labels, the label more often
+// inserted into the other is taken to be the younger, and labels are ordered,
+// oldest first, by the number of labels they are older than less the number they
+// are younger than. The matrix and the ordering are written as TSV to files with
+// the -ages value as a prefix and the suffixes .matrix.tsv and .order.tsv.
+//
+// Each composite with more than one part is given a Gaps attribute describing the
+// genomic gaps between consecutive parts, ordered by position. Each gap is given
+// as its length, the number of bases covered by insertions and the number of bases
+// not covered by insertions. Gaps between abutting or overlapping parts have zero
+// length. For example:
+//
+//	Gaps "1200 1187 13|0 0 0"
+//
+// Composites with insertions where no gap has more than -gap-slack bases not
+// explained by insertions are flagged as high-confidence interrupted elements
+// with an Explained attribute. If -require-explained is set, insertions are only
+// reported for composites that are flagged as explained.
+//
+// If a genome fasta file is given with -genome, the flanks of each insertion
+// are searched for a target-site duplication, a short direct repeat ending near
+// the start of the insertion and starting near its end. Duplications between
+// -tsd-min and -tsd-max bases with boundaries within -tsd-slop bases of the
+// insertion ends are considered, and the longest is reported. The TSD attribute
+// gives the sequence and length of the duplication for each insertion in the
+// order of the TinT attribute, with "." for insertions without a duplication.
+// For example:
+//
+//	TinT 2 "SINE/Alu/AluY 2601 2900 +|DNA/hAT/MER20 4100 4300 -"; TSD "AAGAATGCTTC 11|."
+//
+// Composites are written as GFF by default. With -format bed, composites are
+// written as BED12 with one block per part.
 package main
 
 import (
@@ -19,12 +72,31 @@ import (
 
 	"github.com/biogo/biogo/feat"
 	"github.com/biogo/biogo/io/featio/gff"
-	"github.com/biogo/store/interval"
+
+	"github.com/kortschak/quilt/bed"
+	"github.com/kortschak/quilt/overlap"
 )
 
 var (
 	inFile = flag.String("in", "", "Filename for stitch TinT analysis.")
-	help   = flag.Bool("help", false, "Print this usage message.")
+	format = flag.String("format", "gff", "Output format: gff or bed.")
+	engine = flag.String("engine", "auto", "Overlap engine: tree, sweep or auto to use sweep when all inputs are sorted.")
+
+	nestFile   = flag.String("nest", "", "Filename to write the insertion nesting tree to.")
+	nestFormat = flag.String("nest-format", "gff3", "Nesting tree output format: gff3 or json.")
+
+	agesPrefix = flag.String("ages", "", "Filename prefix to write the relative insertion age analysis to.")
+	agesBy     = flag.String("ages-by", "class", "Label repeats by class or name in the age analysis.")
+
+	gapSlack         = flag.Int("gap-slack", 0, "Number of gap bases that may be unexplained by insertions in an explained gap.")
+	requireExplained = flag.Bool("require-explained", false, "Only report insertions for composites with all gaps explained by insertions.")
+
+	genomeFile = flag.String("genome", "", "Filename of genome fasta for target-site duplication detection.")
+	tsdMin     = flag.Int("tsd-min", 6, "Minimum target-site duplication length.")
+	tsdMax     = flag.Int("tsd-max", 20, "Maximum target-site duplication length.")
+	tsdSlop    = flag.Int("tsd-slop", 10, "Distance from insertion ends to search for target-site duplication boundaries.")
+
+	help = flag.Bool("help", false, "Print this usage message.")
 )
 
 func main() {
@@ -33,87 +105,186 @@ func main() {
 		flag.Usage()
 		os.Exit(0)
 	}
+	switch *format {
+	case "gff", "bed":
+	default:
+		log.Fatalf("unknown output format: %q", *format)
+	}
+	switch *nestFormat {
+	case "gff3", "json":
+	default:
+		log.Fatalf("unknown nesting tree format: %q", *nestFormat)
+	}
+	switch *agesBy {
+	case "class", "name":
+	default:
+		log.Fatalf("unknown age analysis label: %q", *agesBy)
+	}
 
-	f, err := os.Open(*inFile)
+	useSweep, err := overlap.UseSweep(*engine, append([]string{*inFile}, flag.Args()...)...)
 	if err != nil {
-		log.Fatalf("could not open %q: %v", *inFile, err)
+		log.Fatal(err)
+	}
+	if !useSweep && *engine == "auto" {
+		fmt.Fprintln(os.Stderr, "inputs are not sorted: using interval tree.")
 	}
-	fmt.Fprintf(os.Stderr, "reading repeat features from %q.\n", *inFile)
-	in := gff.NewReader(f)
 
-	trees := make(map[string]*interval.IntTree)
-	for {
-		f, err := in.Read()
+	var tsds *tsdFinder
+	if *genomeFile != "" {
+		if *tsdMin < 1 || *tsdMax < *tsdMin || *tsdSlop < 0 {
+			log.Fatal("invalid target-site duplication search parameters")
+		}
+		fmt.Fprintf(os.Stderr, "reading genome from %q.\n", *genomeFile)
+		genome, err := readGenome(*genomeFile)
 		if err != nil {
-			if err != io.EOF {
-				log.Fatalf("failed to read source feature: %v", err)
-			}
-			break
+			log.Fatal(err)
 		}
+		tsds = &tsdFinder{genome: genome, min: *tsdMin, max: *tsdMax, slop: *tsdSlop}
+	}
 
-		c := composite{Feature: f.(*gff.Feature)}
-		if c.Source != "stitch" {
-			continue
+	gw := gff.NewWriter(os.Stdout, 60, *format == "gff")
+	bw := bed.NewWriter(os.Stdout)
+	haveInsertion := make(map[*gff.Feature][]*gff.Feature)
+	var nest *nesting
+	if *nestFile != "" || *agesPrefix != "" {
+		nest = newNesting()
+	}
+	write := func(ref feat.Feature) {
+		c := ref.(composite)
+		in := c.Feature
+		f, ok := haveInsertion[in]
+		delete(haveInsertion, in)
+		g := gaps(c, f)
+		explained := isExplained(g, *gapSlack)
+		if *requireExplained && !explained {
+			ok = false
 		}
-
-		parts := c.FeatAttributes.Get("Parts")
-		if parts == "" {
-			log.Fatal("missing parts tag: file not a stitch gff.")
+		if len(g) != 0 {
+			in.FeatAttributes = append(in.FeatAttributes, gff.Attribute{
+				Tag:   "Gaps",
+				Value: formatGaps(g),
+			})
+			if explained && ok {
+				in.FeatAttributes = append(in.FeatAttributes, gff.Attribute{
+					Tag:   "Explained",
+					Value: "yes",
+				})
+			}
+		}
+		if ok {
+			if nest != nil {
+				nest.add(in, f)
+			}
+			sort.Sort(byGenomeLocation(f))
+			in.Source = "patch"
+			in.FeatAttributes = append(in.FeatAttributes, gff.Attribute{
+				Tag:   "TinT",
+				Value: formatInsertions(f),
+			})
+			if tsds != nil {
+				in.FeatAttributes = append(in.FeatAttributes, gff.Attribute{
+					Tag:   "TSD",
+					Value: formatTSDs(*tsds, f),
+				})
+			}
+		}
+		var err error
+		switch *format {
+		case "gff":
+			_, err = gw.Write(in)
+		case "bed":
+			err = bw.Write(bedRecord(c))
 		}
-		parts, err = strconv.Unquote(parts)
 		if err != nil {
-			log.Fatalf("failed to unquote parts: %v", err)
+			log.Fatalf("failed to write composite: %v", err)
 		}
+	}
 
-		for _, p := range strings.Split(parts, "|") {
-			fields := strings.Fields(p)
-			if len(fields) != 5 {
-				log.Fatalf("unexpected number of fields in %q: %v", p, c.Feature)
-			}
-			left, err := strconv.Atoi(fields[3])
-			if err != nil {
-				log.Fatalf("failed to parse left coordinate: %v", fields[3])
-			}
-			right, err := strconv.Atoi(fields[3])
-			if err != nil {
-				log.Fatalf("failed to parse right coordinate: %v", fields[4])
+	if useSweep {
+		err = sweep(*inFile, flag.Args(), haveInsertion, write)
+	} else {
+		err = walk(*inFile, flag.Args(), haveInsertion, write)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *nestFile != "" {
+		err = writeFile(*nestFile, func(w io.Writer) error {
+			switch *nestFormat {
+			case "json":
+				return writeNestJSON(w, nest.roots())
+			default:
+				return writeNestGFF3(w, nest.roots())
 			}
-			c.parts = append(c.parts, part{left: left, right: right})
+		})
+		if err != nil {
+			log.Fatal(err)
 		}
+	}
 
-		t, ok := trees[c.SeqName]
-		if !ok {
-			t = &interval.IntTree{}
-			trees[c.Feature.SeqName] = t
+	if *agesPrefix != "" {
+		age := agesOf(nest, *agesBy == "name")
+		ranks := age.order()
+		err = writeFile(*agesPrefix+".matrix.tsv", func(w io.Writer) error { return age.writeMatrix(w, ranks) })
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = writeFile(*agesPrefix+".order.tsv", func(w io.Writer) error { return writeOrder(w, ranks) })
+		if err != nil {
+			log.Fatal(err)
 		}
-		c.id = uintptr(t.Len())
-		t.Insert(c, true)
 	}
-	f.Close()
+}
 
-	var chroms []string
-	for chr, t := range trees {
-		t.AdjustRanges()
-		chroms = append(chroms, chr)
+// writeFile creates the named file and writes to it using fn.
+func writeFile(name string, fn func(io.Writer) error) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("could not create %q: %v", name, err)
 	}
-	sort.Strings(chroms)
+	err = fn(f)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %q: %v", name, err)
+	}
+	return f.Close()
+}
 
-	haveInsertion := make(map[*gff.Feature][]*gff.Feature)
-	for _, q := range flag.Args() {
-		if q == *inFile {
-			// We already have this in memory, so don't read it again.
-			for _, t := range trees {
-				t.Do(func(i interval.IntInterface) (done bool) {
-					noteComposite(i.(composite).Feature, trees, haveInsertion)
-					return
-				})
+// walk finds insertions into the composites in the named file using an
+// interval tree, and then calls write for each composite in order.
+func walk(file string, queries []string, haveInsertion map[*gff.Feature][]*gff.Feature, write func(feat.Feature)) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("could not open %q: %v", file, err)
+	}
+	fmt.Fprintf(os.Stderr, "reading repeat features from %q.\n", file)
+	tree := overlap.NewTree()
+	next := composites(gff.NewReader(f))
+	for {
+		c, err := next()
+		if err != nil {
+			if err != io.EOF {
+				return err
 			}
+			break
+		}
+		tree.Insert(c)
+	}
+	f.Close()
+
+	for _, q := range queries {
+		if q == file {
+			// We already have this in memory, so don't read it again.
+			tree.Do(func(ref feat.Feature) {
+				noteComposite(ref.(composite).Feature, tree, haveInsertion)
+			})
 			continue
 		}
 
 		f, err := os.Open(q)
 		if err != nil {
-			log.Fatalf("could not open %q: %v", q, err)
+			return fmt.Errorf("could not open %q: %v", q, err)
 		}
 		fmt.Fprintf(os.Stderr, "reading repeat features from %q.\n", q)
 		in := gff.NewReader(f)
@@ -122,52 +293,244 @@ func main() {
 			f, err := in.Read()
 			if err != nil {
 				if err != io.EOF {
-					log.Fatalf("failed to read source feature: %v", err)
+					return fmt.Errorf("failed to read source feature: %v", err)
 				}
 				break
 			}
 
-			noteComposite(f.(*gff.Feature), trees, haveInsertion)
+			noteComposite(f.(*gff.Feature), tree, haveInsertion)
 		}
 		f.Close()
 	}
 
-	w := gff.NewWriter(os.Stdout, 60, true)
-	for _, chr := range chroms {
-		trees[chr].Do(func(i interval.IntInterface) (done bool) {
-			in := i.(composite).Feature
-			if f, ok := haveInsertion[in]; ok {
-				sort.Sort(byGenomeLocation(f))
-				in.Source = "patch"
-				in.FeatAttributes = append(in.FeatAttributes, gff.Attribute{
-					Tag:   "TinT",
-					Value: formatInsertions(f),
-				})
+	tree.Do(write)
+	return nil
+}
+
+// sweep finds insertions into the composites in the named file using a
+// sweep line over the sorted query files, calling write for each composite
+// in order once no later query can be inserted into it.
+func sweep(file string, queries []string, haveInsertion map[*gff.Feature][]*gff.Feature, write func(feat.Feature)) error {
+	cf, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("could not open %q: %v", file, err)
+	}
+	defer cf.Close()
+	fmt.Fprintf(os.Stderr, "streaming repeat features from %q.\n", file)
+	s := overlap.NewSweep(composites(gff.NewReader(cf)))
+	s.Retire = write
+
+	streams := make([]overlap.Stream, len(queries))
+	for i, q := range queries {
+		f, err := os.Open(q)
+		if err != nil {
+			return fmt.Errorf("could not open %q: %v", q, err)
+		}
+		defer f.Close()
+		fmt.Fprintf(os.Stderr, "streaming repeat features from %q.\n", q)
+		streams[i] = overlap.GFFStream(gff.NewReader(f))
+	}
+	next := overlap.Merge(streams...)
+	for {
+		f, err := next()
+		if err != nil {
+			if err != io.EOF {
+				return fmt.Errorf("failed to read source feature: %v", err)
 			}
-			w.Write(in)
-			return
-		})
+			break
+		}
+		err = noteComposite(f.(*gff.Feature), s, haveInsertion)
+		if err != nil {
+			return fmt.Errorf("failed to find composites for %v: %v", f, err)
+		}
+	}
+	return s.Close()
+}
+
+// bedRecord returns a BED12 record for c with a block for each part,
+// named by class and the name of the first part.
+func bedRecord(c composite) bed.Record {
+	class, _ := strconv.Unquote(c.FeatAttributes.Get("Class"))
+	blocks := make([]bed.Block, len(c.parts))
+	for i, p := range c.parts {
+		blocks[i] = bed.Block{Start: p.left, End: p.right}
+	}
+	var score float64
+	if c.FeatScore != nil {
+		score = *c.FeatScore
+	}
+	return bed.Record{
+		Chrom:  c.SeqName,
+		Name:   class + "/" + c.parts[0].name,
+		Class:  class,
+		Score:  score,
+		Strand: c.FeatStrand,
+		Blocks: blocks,
+	}
+}
+
+// composites returns a Stream of the stitch composites read by r.
+func composites(r *gff.Reader) overlap.Stream {
+	return func() (feat.Feature, error) {
+		for {
+			f, err := r.Read()
+			if err != nil {
+				if err != io.EOF {
+					err = fmt.Errorf("failed to read source feature: %v", err)
+				}
+				return nil, err
+			}
+			gf := f.(*gff.Feature)
+			if gf.Source != "stitch" {
+				continue
+			}
+			return newComposite(gf)
+		}
 	}
 }
 
-func noteComposite(f *gff.Feature, trees map[string]*interval.IntTree, hasInsertion map[*gff.Feature][]*gff.Feature) {
-	t, ok := trees[f.SeqName]
-	if !ok {
-		return
+// newComposite returns a composite parsed from the stitch feature f.
+func newComposite(f *gff.Feature) (composite, error) {
+	c := composite{Feature: f}
+
+	parts := c.FeatAttributes.Get("Parts")
+	if parts == "" {
+		return c, fmt.Errorf("missing parts tag: file not a stitch gff.")
+	}
+	parts, err := strconv.Unquote(parts)
+	if err != nil {
+		return c, fmt.Errorf("failed to unquote parts: %v", err)
 	}
-	for _, m := range t.Get((*query)(f)) {
-		inGap := true
-		in := m.(composite)
+
+	for _, p := range strings.Split(parts, "|") {
+		fields := strings.Fields(p)
+		if len(fields) != 5 {
+			return c, fmt.Errorf("unexpected number of fields in %q: %v", p, c.Feature)
+		}
+		left, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return c, fmt.Errorf("failed to parse left coordinate: %v", fields[3])
+		}
+		right, err := strconv.Atoi(fields[4])
+		if err != nil {
+			return c, fmt.Errorf("failed to parse right coordinate: %v", fields[4])
+		}
+		c.parts = append(c.parts, part{name: fields[0], left: feat.OneToZero(left), right: right})
+	}
+	return c, nil
+}
+
+// noteComposite records f as an insertion into each composite found by
+// finder that contains f without f overlapping any of its parts.
+func noteComposite(f *gff.Feature, finder overlap.Finder, hasInsertion map[*gff.Feature][]*gff.Feature) error {
+	return finder.Find(f, func(ref feat.Feature) {
+		in := ref.(composite)
+		if f.FeatStart < in.FeatStart || f.FeatEnd > in.FeatEnd {
+			return
+		}
 		for _, p := range in.parts {
 			if f.FeatStart < p.right && f.FeatEnd > p.left {
-				inGap = false
-				break
+				return
 			}
 		}
-		if inGap {
-			hasInsertion[in.Feature] = append(hasInsertion[in.Feature], f)
+		hasInsertion[in.Feature] = append(hasInsertion[in.Feature], f)
+	})
+}
+
+// gap is the genomic gap between consecutive composite parts.
+type gap struct {
+	// length is the length of the gap, or
+	// zero if the parts abut or overlap.
+	length int
+
+	// covered is the number of bases of
+	// the gap covered by insertions.
+	covered int
+}
+
+// gaps returns the gaps between consecutive parts of c ordered by genomic
+// position and the bases of each gap covered by the features in ins.
+func gaps(c composite, ins []*gff.Feature) []gap {
+	if len(c.parts) < 2 {
+		return nil
+	}
+	parts := make([]part, len(c.parts))
+	copy(parts, c.parts)
+	sort.Sort(byPartLeft(parts))
+
+	g := make([]gap, len(parts)-1)
+	right := parts[0].right
+	for i, p := range parts[1:] {
+		if p.left > right {
+			g[i].length = p.left - right
+			g[i].covered = covered(right, p.left, ins)
+		}
+		if p.right > right {
+			right = p.right
+		}
+	}
+	return g
+}
+
+// covered returns the number of bases in [left, right) covered by the
+// features in f.
+func covered(left, right int, f []*gff.Feature) int {
+	var iv []part
+	for _, e := range f {
+		l, r := e.FeatStart, e.FeatEnd
+		if l < left {
+			l = left
+		}
+		if r > right {
+			r = right
+		}
+		if l < r {
+			iv = append(iv, part{left: l, right: r})
+		}
+	}
+	sort.Sort(byPartLeft(iv))
+	var n int
+	end := left
+	for _, e := range iv {
+		if e.left > end {
+			end = e.left
+		}
+		if e.right > end {
+			n += e.right - end
+			end = e.right
+		}
+	}
+	return n
+}
+
+// isExplained returns whether g has at least one gap and all gaps in g
+// have no more than slack bases not covered by insertions.
+func isExplained(g []gap, slack int) bool {
+	var n int
+	for _, e := range g {
+		if e.length == 0 {
+			continue
+		}
+		if e.length-e.covered > slack {
+			return false
 		}
+		n++
 	}
+	return n != 0
+}
+
+func formatGaps(g []gap) string {
+	var buf bytes.Buffer
+	for i, e := range g {
+		if i == 0 {
+			buf.WriteByte('"')
+		} else {
+			buf.WriteByte('|')
+		}
+		fmt.Fprintf(&buf, "%d %d %d", e.length, e.covered, e.length-e.covered)
+	}
+	buf.WriteByte('"')
+	return buf.String()
 }
 
 func formatInsertions(p []*gff.Feature) string {
@@ -196,30 +559,20 @@ func formatInsertions(p []*gff.Feature) string {
 
 type composite struct {
 	*gff.Feature
-	id uintptr
 
 	parts []part
 }
 
 type part struct {
+	name        string
 	left, right int
 }
 
-// Overlap returns whether q overlaps b.
-func (c composite) Overlap(b interval.IntRange) bool {
-	return c.FeatEnd > b.Start && c.FeatStart < b.End
-}
-func (c composite) ID() uintptr              { return c.id }
-func (c composite) Range() interval.IntRange { return interval.IntRange{c.FeatStart, c.FeatEnd} }
-
-type query gff.Feature
+type byPartLeft []part
 
-// Overlap returns whether q is entirely within b.
-func (q *query) Overlap(b interval.IntRange) bool {
-	return q.FeatStart >= b.Start && q.FeatEnd <= b.End
-}
-func (q *query) ID() uintptr              { return 0 }
-func (q *query) Range() interval.IntRange { return interval.IntRange{q.FeatStart, q.FeatEnd} }
+func (p byPartLeft) Len() int           { return len(p) }
+func (p byPartLeft) Less(i, j int) bool { return p[i].left < p[j].left }
+func (p byPartLeft) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
 
 type byGenomeLocation []*gff.Feature
 
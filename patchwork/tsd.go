@@ -0,0 +1,142 @@
+// Copyright ©2015 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/biogo/biogo/alphabet"
+	"github.com/biogo/biogo/io/featio/gff"
+	"github.com/biogo/biogo/io/seqio"
+	"github.com/biogo/biogo/io/seqio/fasta"
+	"github.com/biogo/biogo/seq/linear"
+)
+
+// readGenome returns the sequences in the named fasta file keyed by name.
+func readGenome(file string) (map[string]alphabet.Letters, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open genome %q: %v", file, err)
+	}
+	defer f.Close()
+
+	genome := make(map[string]alphabet.Letters)
+	sc := seqio.NewScanner(fasta.NewReader(f, linear.NewSeq("", nil, alphabet.DNA)))
+	for sc.Next() {
+		s := sc.Seq().(*linear.Seq)
+		genome[s.Name()] = s.Seq
+	}
+	if sc.Error() != nil {
+		return nil, fmt.Errorf("failed during genome read: %v", sc.Error())
+	}
+	return genome, nil
+}
+
+// tsdFinder finds target-site duplications flanking insertions.
+type tsdFinder struct {
+	genome map[string]alphabet.Letters
+
+	// min and max are the minimum and
+	// maximum length of a TSD.
+	min, max int
+
+	// slop is the distance either side of
+	// an insertion end that a TSD boundary
+	// may be placed to allow for imprecise
+	// annotation.
+	slop int
+}
+
+// find returns the sequence of the longest direct repeat ending near the
+// start of f and starting near the end of f. Among repeats of equal
+// length, the repeat closest to the annotated ends of f is returned. If no
+// repeat is found, ok is false.
+func (t tsdFinder) find(f *gff.Feature) (tsd string, ok bool) {
+	s, found := t.genome[f.SeqName]
+	if !found {
+		return "", false
+	}
+	for n := t.max; n >= t.min; n-- {
+		best := -1
+		var match alphabet.Letters
+		for i := -t.slop; i <= t.slop; i++ {
+			le := f.FeatStart + i
+			if le-n < 0 || le > len(s) {
+				continue
+			}
+			left := s[le-n : le]
+			for j := -t.slop; j <= t.slop; j++ {
+				rs := f.FeatEnd + j
+				if rs < 0 || rs+n > len(s) || rs < le {
+					continue
+				}
+				if dist := abs(i) + abs(j); (best < 0 || dist < best) && same(left, s[rs:rs+n]) {
+					best = dist
+					match = left
+				}
+			}
+		}
+		if best >= 0 {
+			return strings.ToUpper(match.String()), true
+		}
+	}
+	return "", false
+}
+
+// same returns whether a and b are the same unambiguous
+// nucleotide sequence, ignoring case.
+func same(a, b alphabet.Letters) bool {
+	for i, l := range a {
+		u := upper(l)
+		if u != upper(b[i]) {
+			return false
+		}
+		switch u {
+		case 'A', 'C', 'G', 'T':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func upper(l alphabet.Letter) alphabet.Letter {
+	if 'a' <= l && l <= 'z' {
+		return l - 'a' + 'A'
+	}
+	return l
+}
+
+func abs(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+// formatTSDs returns the TSD attribute value for the insertions in p.
+// Each TSD is given as its sequence and length, with "." for insertions
+// without a detected TSD.
+func formatTSDs(t tsdFinder, p []*gff.Feature) string {
+	var buf bytes.Buffer
+	for i, f := range p {
+		if i == 0 {
+			buf.WriteByte('"')
+		} else {
+			buf.WriteByte('|')
+		}
+		d, ok := t.find(f)
+		if !ok {
+			buf.WriteByte('.')
+			continue
+		}
+		fmt.Fprintf(&buf, "%s %d", d, len(d))
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
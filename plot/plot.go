@@ -0,0 +1,166 @@
+// Copyright ©2015 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// plot renders the stitch composites in a genomic region as SVG dot plots.
+//
+// Repeat features are read from the GFF files named on the command line, or
+// from stdin if no files are given. Files may be any mix of stitch GFF output
+// and the rm2gff or tailor simple repeats that were stitched. Features with a
+// Parts attribute are treated as composites and features with a Repeat attribute
+// are treated as simple repeats. Other features are ignored.
+//
+// An SVG rendering of the composites and simple repeats overlapping the region
+// given by -region chr:start-end, with a one-based start, is written to stdout.
+// Each composite is drawn as a dot plot of genomic position against consensus
+// position, with the links between parts annotated with the stitch cost of the
+// link and the simple repeats in the gaps between parts shaded as insertions.
+// The simple repeats in the region are drawn as a track below, coloured by class
+// and outlined if they are a part of a composite.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/biogo/biogo/feat"
+	"github.com/biogo/biogo/io/featio/gff"
+
+	"github.com/kortschak/quilt/chain"
+)
+
+var (
+	regionFlag = flag.String("region", "", "Region to plot as chr:start-end.")
+	help       = flag.Bool("help", false, "Print this usage message.")
+)
+
+func main() {
+	flag.Parse()
+	if *help || *regionFlag == "" {
+		flag.Usage()
+		os.Exit(0)
+	}
+	region, err := parseRegion(*regionFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var (
+		composites []chain.Composite
+		repeats    []*chain.Simple
+	)
+	if len(flag.Args()) == 0 {
+		composites, repeats, err = readFeatures(os.Stdin, region, composites, repeats)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	for _, file := range flag.Args() {
+		f, err := os.Open(file)
+		if err != nil {
+			log.Fatalf("could not open %q: %v", file, err)
+		}
+		fmt.Fprintf(os.Stderr, "reading repeat features from %q\n", file)
+		composites, repeats, err = readFeatures(f, region, composites, repeats)
+		f.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	sort.Sort(byGenomeLocation(composites))
+	err = writePlot(os.Stdout, region, composites, repeats)
+	if err != nil {
+		log.Fatalf("failed to write plot: %v", err)
+	}
+}
+
+// parseRegion returns the location described by s in the form chr:start-end
+// with a one-based start.
+func parseRegion(s string) (chain.Location, error) {
+	i := strings.LastIndex(s, ":")
+	if i < 0 {
+		return chain.Location{}, fmt.Errorf("invalid region %q: missing ':'", s)
+	}
+	j := strings.LastIndex(s, "-")
+	if j < i {
+		return chain.Location{}, fmt.Errorf("invalid region %q: missing '-'", s)
+	}
+	start, err := strconv.Atoi(strings.Replace(s[i+1:j], ",", "", -1))
+	if err != nil {
+		return chain.Location{}, fmt.Errorf("invalid region start %q: %v", s, err)
+	}
+	end, err := strconv.Atoi(strings.Replace(s[j+1:], ",", "", -1))
+	if err != nil {
+		return chain.Location{}, fmt.Errorf("invalid region end %q: %v", s, err)
+	}
+	if start < 1 || end < start {
+		return chain.Location{}, fmt.Errorf("invalid region %q", s)
+	}
+	return chain.Location{Chrom: s[:i], Left: feat.OneToZero(start), Right: end}, nil
+}
+
+// readFeatures appends the composites and simple repeats on the chromosome
+// of region read from r to composites and repeats.
+func readFeatures(r io.Reader, region chain.Location, composites []chain.Composite, repeats []*chain.Simple) ([]chain.Composite, []*chain.Simple, error) {
+	in := gff.NewReader(r)
+	for {
+		f, err := in.Read()
+		if err != nil {
+			if err != io.EOF {
+				return composites, repeats, fmt.Errorf("failed to read source feature: %v", err)
+			}
+			return composites, repeats, nil
+		}
+		gf := f.(*gff.Feature)
+		if gf.SeqName != region.Chrom {
+			continue
+		}
+		switch {
+		case gf.FeatAttributes.Get("Parts") != "":
+			c, err := newComposite(gf)
+			if err != nil {
+				return composites, repeats, err
+			}
+			composites = append(composites, c)
+		case gf.FeatAttributes.Get("Repeat") != "":
+			s, err := chain.NewSimple(gf)
+			if err != nil {
+				return composites, repeats, err
+			}
+			repeats = append(repeats, s)
+		}
+	}
+}
+
+// newComposite returns the composite described by the stitch feature f.
+func newComposite(f *gff.Feature) (chain.Composite, error) {
+	var c chain.Composite
+	var err error
+	c.Class, err = strconv.Unquote(f.FeatAttributes.Get("Class"))
+	if err != nil {
+		return c, fmt.Errorf("failed to unquote class: %v", err)
+	}
+	c.Parts, err = chain.ParseParts(f.FeatAttributes.Get("Parts"), f.SeqName, f.FeatStrand)
+	if err != nil {
+		return c, fmt.Errorf("%v: %v", err, f)
+	}
+	if f.FeatScore != nil {
+		c.Score = *f.FeatScore
+	}
+	return c, nil
+}
+
+type byGenomeLocation []chain.Composite
+
+func (c byGenomeLocation) Len() int { return len(c) }
+func (c byGenomeLocation) Less(i, j int) bool {
+	return c[i].Parts[0].Genomic.Left < c[j].Parts[0].Genomic.Left
+}
+func (c byGenomeLocation) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
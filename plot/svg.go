@@ -0,0 +1,195 @@
+// Copyright ©2015 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+
+	"github.com/biogo/biogo/feat"
+	"github.com/biogo/biogo/seq"
+
+	"github.com/kortschak/quilt/bed"
+	"github.com/kortschak/quilt/chain"
+)
+
+// Plot dimensions.
+const (
+	plotWidth   = 600
+	plotHeight  = 300
+	trackHeight = 12
+	plotMargin  = 50
+)
+
+// writePlot writes an SVG rendering of the composites and simple repeats
+// overlapping region to w. Each composite is drawn as a dot plot of genomic
+// position against consensus position with each part drawn as a segment, and
+// the links between consecutive parts annotated with the cost function value
+// of the link. Simple repeats lying within the gaps between parts are shaded
+// as insertions. The simple repeats in the region are drawn as a track below
+// the composites, coloured by class and outlined if they are part of a
+// composite.
+func writePlot(w io.Writer, region chain.Location, all []chain.Composite, repeats []*chain.Simple) error {
+	var cs []chain.Composite
+	for _, c := range all {
+		if c.Parts[0].Genomic.Chrom == region.Chrom && c.Parts[0].Genomic.Left < region.Right && region.Left < c.End() {
+			cs = append(cs, c)
+		}
+	}
+	var rs []*chain.Simple
+	for _, r := range repeats {
+		if r.Genomic.Overlaps(region) {
+			rs = append(rs, r)
+		}
+	}
+	inComposite := make(map[chain.Location]bool)
+	for _, c := range cs {
+		for _, p := range c.Parts {
+			inComposite[p.Genomic] = true
+		}
+	}
+
+	panel := plotHeight + 2*plotMargin
+	width := plotWidth + 2*plotMargin
+	height := len(cs)*panel + len(rs)*trackHeight + 2*plotMargin
+	_, err := fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="10">
+`, width, height)
+	if err != nil {
+		return err
+	}
+	for i, c := range cs {
+		err = plotComposite(w, c, rs, plotMargin, i*panel+plotMargin)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Draw the track of simple repeats.
+	top := len(cs)*panel + plotMargin
+	x := scale{min: region.Left, max: region.Right, off: plotMargin, size: plotWidth}
+	fmt.Fprintf(w, `<text x="%d" y="%d" font-weight="bold">%s:%d-%d</text>
+<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="black"/>
+`, plotMargin, top-20, html.EscapeString(region.Chrom), feat.ZeroToOne(region.Left), region.Right,
+		plotMargin, top-5, plotMargin+plotWidth, top-5)
+	for i, r := range rs {
+		y := top + i*trackHeight
+		stroke := "none"
+		if inComposite[r.Genomic] {
+			stroke = "black"
+		}
+		_, err = fmt.Fprintf(w, `<rect x="%.2f" y="%d" width="%.2f" height="%d" fill="rgb(%s)" stroke="%s"><title>%s %s %s %d-%d</title></rect>
+`, x.at(r.Genomic.Left), y, x.at(r.Genomic.Right)-x.at(r.Genomic.Left), trackHeight-2, bed.Color(r.Class), stroke,
+			html.EscapeString(r.Name), html.EscapeString(r.Class), r.Genomic.Strand, feat.ZeroToOne(r.Genomic.Left), r.Genomic.Right)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintln(w, "</svg>")
+	return err
+}
+
+// plotComposite draws the dot plot of c with its top left corner at (left, top).
+// Simple repeats in rs lying within the gaps between parts are shaded.
+func plotComposite(w io.Writer, c chain.Composite, rs []*chain.Simple, left, top int) error {
+	start, end := c.Parts[0].Genomic.Left, c.End()
+	cons := 0
+	for _, p := range c.Parts {
+		if p.Right > cons {
+			cons = p.Right
+		}
+	}
+	x := scale{min: start, max: end, off: left, size: plotWidth}
+	y := scale{min: 0, max: cons, off: top, size: plotHeight, flip: true}
+
+	fmt.Fprintf(w, `<text x="%d" y="%d" font-weight="bold">%s %s %s:%d-%d(%s) score=%.4g</text>
+<rect x="%d" y="%d" width="%d" height="%d" fill="none" stroke="black"/>
+<text x="%d" y="%d">%d</text>
+<text x="%d" y="%d" text-anchor="end">%d</text>
+<text x="%d" y="%d" text-anchor="end">%d</text>
+<text x="%d" y="%d" text-anchor="end">0</text>
+`,
+		left, top-10, html.EscapeString(c.Class), html.EscapeString(c.Parts[0].Name),
+		html.EscapeString(c.Parts[0].Genomic.Chrom), feat.ZeroToOne(start), end, c.Parts[0].Genomic.Strand, c.Score,
+		left, top, plotWidth, plotHeight,
+		left, top+plotHeight+12, feat.ZeroToOne(start),
+		left+plotWidth, top+plotHeight+12, end,
+		left-3, top+10, cons,
+		left-3, top+plotHeight,
+	)
+
+	// Shade insertions in the gaps between parts.
+	for i, p := range c.Parts[1:] {
+		gl, gr := c.Parts[i].Genomic.Right, p.Genomic.Left
+		if gr <= gl {
+			continue
+		}
+		fmt.Fprintf(w, `<rect x="%.2f" y="%d" width="%.2f" height="%d" fill="#eeeeee"/>
+`, x.at(gl), top, x.at(gr)-x.at(gl), plotHeight)
+		for _, r := range rs {
+			if r.Genomic.Left >= gl && r.Genomic.Right <= gr {
+				fmt.Fprintf(w, `<rect x="%.2f" y="%d" width="%.2f" height="%d" fill="rgb(%s)" fill-opacity="0.3"><title>%s %s</title></rect>
+`, x.at(r.Genomic.Left), top, x.at(r.Genomic.Right)-x.at(r.Genomic.Left), plotHeight,
+					bed.Color(r.Class), html.EscapeString(r.Name), html.EscapeString(r.Class))
+			}
+		}
+	}
+
+	// Draw parts and the links between them.
+	for i, p := range c.Parts {
+		x0, x1 := x.at(p.Genomic.Left), x.at(p.Genomic.Right)
+		y0, y1 := y.at(p.Left), y.at(p.Right)
+		if p.Genomic.Strand == seq.Minus {
+			y0, y1 = y1, y0
+		}
+		fmt.Fprintf(w, `<line x1="%.2f" y1="%.2f" x2="%.2f" y2="%.2f" stroke="rgb(%s)" stroke-width="3"><title>%s %d-%d</title></line>
+`, x0, y0, x1, y1, bed.Color(c.Class), html.EscapeString(p.Name), feat.ZeroToOne(p.Left), p.Right)
+		if i == 0 {
+			continue
+		}
+		l := c.Parts[i-1]
+		lx, ly := x.at(l.Genomic.Right), y.at(l.Right)
+		if l.Genomic.Strand == seq.Minus {
+			ly = y.at(l.Left)
+		}
+		cost, ok := linkCost(l, p)
+		label := "no link"
+		if ok {
+			label = fmt.Sprintf("cost=%.4g", cost)
+		}
+		_, err := fmt.Fprintf(w, `<line x1="%.2f" y1="%.2f" x2="%.2f" y2="%.2f" stroke="grey" stroke-dasharray="3,3"/>
+<text x="%.2f" y="%.2f" text-anchor="middle" fill="firebrick">%s</text>
+`, lx, ly, x0, y0, (lx+x0)/2, (ly+y0)/2-4, label)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// linkCost returns the cost that the stitch cost function assigns to
+// the link between the parts left and right.
+func linkCost(left, right chain.Part) (cost float64, ok bool) {
+	s, ok := chain.Cost(left.Simple(), right.Simple())
+	return -s, ok
+}
+
+// scale maps coordinates in [min, max] onto size pixels starting at off.
+type scale struct {
+	min, max  int
+	off, size int
+	flip      bool
+}
+
+func (s scale) at(v int) float64 {
+	f := 0.0
+	if s.max > s.min {
+		f = float64(v-s.min) / float64(s.max-s.min)
+	}
+	if s.flip {
+		f = 1 - f
+	}
+	return float64(s.off) + f*float64(s.size)
+}
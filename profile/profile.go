@@ -0,0 +1,359 @@
+// Copyright ©2015 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// profile builds consensus coverage profiles for repeat families.
+//
+// Repeat features are read from the GFF files named on the command line, or
+// from stdin if no files are given. Simple repeats, features with a Repeat
+// attribute, contribute the consensus interval given by their Repeat attribute
+// to the profile of their repeat name. Composites, features with a Parts
+// attribute, contribute the union of the consensus intervals of their parts
+// with each name to the profile of that name, so that each composite is counted
+// at most once at each consensus position. Profiles are built separately for
+// simple repeats and composites.
+//
+// With -format tsv, the depth at each consensus position is written as
+// tab separated type, name, one-based position and depth, and the fraction of
+// the features of the type and name covering the position. Simple repeat
+// profiles extend to the longest consensus length given by the Repeat
+// attributes of the name. Composite profiles extend to the right-most
+// covered position. With -format bedgraph, runs of equal depth are written as
+// bedGraph in consensus coordinates with the repeat name as the sequence name,
+// with a track for each type.
+//
+// Profiles may be restricted to the types and names given by the -type and
+// -name flags.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/biogo/biogo/feat"
+	"github.com/biogo/biogo/io/featio/gff"
+
+	"github.com/kortschak/quilt/chain"
+)
+
+var (
+	format = flag.String("format", "tsv", "Output format: tsv or bedgraph.")
+	kind   = flag.String("type", "all", "Profiles to build: all, simple or composite.")
+	names  = flag.String("name", "", "Comma separated list of repeat names to profile (default all).")
+	help   = flag.Bool("help", false, "Print this usage message.")
+)
+
+func main() {
+	flag.Parse()
+	if *help {
+		flag.Usage()
+		os.Exit(0)
+	}
+	switch *format {
+	case "tsv", "bedgraph":
+	default:
+		log.Fatalf("unknown output format: %q", *format)
+	}
+	switch *kind {
+	case "all", "simple", "composite":
+	default:
+		log.Fatalf("unknown profile type: %q", *kind)
+	}
+
+	p := profiles{
+		kind:      *kind,
+		simple:    make(map[string]*profile),
+		composite: make(map[string]*profile),
+	}
+	if *names != "" {
+		p.names = make(map[string]bool)
+		for _, n := range strings.Split(*names, ",") {
+			p.names[strings.TrimSpace(n)] = true
+		}
+	}
+
+	if len(flag.Args()) == 0 {
+		err := p.read(os.Stdin)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	for _, file := range flag.Args() {
+		f, err := os.Open(file)
+		if err != nil {
+			log.Fatalf("could not open %q: %v", file, err)
+		}
+		fmt.Fprintf(os.Stderr, "reading repeat features from %q\n", file)
+		err = p.read(f)
+		f.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	var err error
+	switch *format {
+	case "tsv":
+		err = p.writeTSV(w)
+	case "bedgraph":
+		err = p.writeBedGraph(w)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		log.Fatalf("failed to write profiles: %v", err)
+	}
+}
+
+// profile is the consensus coverage of a repeat name.
+type profile struct {
+	// n is the number of features contributing
+	// to the profile.
+	n int
+
+	// length is the length of the profile.
+	length int
+
+	// diff holds the change in depth at each
+	// consensus position.
+	diff []int
+}
+
+// add adds the zero-based half-open consensus interval [left, right)
+// to the profile.
+func (p *profile) add(left, right int) {
+	if right > p.length {
+		p.length = right
+	}
+	for len(p.diff) <= right {
+		p.diff = append(p.diff, 0)
+	}
+	p.diff[left]++
+	p.diff[right]--
+}
+
+// depth returns the depth of coverage at each consensus position.
+func (p *profile) depth() []int {
+	d := make([]int, p.length)
+	var n int
+	for i := range d {
+		if i < len(p.diff) {
+			n += p.diff[i]
+		}
+		d[i] = n
+	}
+	return d
+}
+
+// profiles holds the simple and composite profiles of each repeat name.
+type profiles struct {
+	kind  string
+	names map[string]bool
+
+	simple    map[string]*profile
+	composite map[string]*profile
+}
+
+func (p profiles) wants(name string) bool {
+	return p.names == nil || p.names[name]
+}
+
+func get(m map[string]*profile, name string) *profile {
+	p, ok := m[name]
+	if !ok {
+		p = &profile{}
+		m[name] = p
+	}
+	return p
+}
+
+// read adds the repeat features read from r to p.
+func (p profiles) read(r io.Reader) error {
+	in := gff.NewReader(r)
+	for {
+		f, err := in.Read()
+		if err != nil {
+			if err != io.EOF {
+				return fmt.Errorf("failed to read source feature: %v", err)
+			}
+			return nil
+		}
+		gf := f.(*gff.Feature)
+		switch {
+		case gf.FeatAttributes.Get("Parts") != "":
+			if p.kind == "simple" {
+				continue
+			}
+			err = p.addComposite(gf)
+		case gf.FeatAttributes.Get("Repeat") != "":
+			if p.kind == "composite" {
+				continue
+			}
+			err = p.addSimple(gf)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (p profiles) addSimple(f *gff.Feature) error {
+	fields := strings.Fields(f.FeatAttributes.Get("Repeat"))
+	if len(fields) != 5 {
+		return fmt.Errorf("bad repeat attribute: %v", f)
+	}
+	if !p.wants(fields[0]) {
+		return nil
+	}
+	if fields[2] == "." || fields[3] == "." {
+		return nil
+	}
+	var c [3]int
+	for i, s := range fields[2:] {
+		var err error
+		c[i], err = strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("failed to parse repeat coordinate: %v", err)
+		}
+	}
+	if c[0] < 1 || c[1] < c[0] {
+		return nil
+	}
+	left, right, remains := feat.OneToZero(c[0]), c[1], c[2]
+	pr := get(p.simple, fields[0])
+	pr.n++
+	pr.add(left, right)
+	if right+remains > pr.length {
+		pr.length = right + remains
+	}
+	return nil
+}
+
+func (p profiles) addComposite(f *gff.Feature) error {
+	parts, err := chain.ParseParts(f.FeatAttributes.Get("Parts"), f.SeqName, f.FeatStrand)
+	if err != nil {
+		return err
+	}
+	byName := make(map[string][][2]int)
+	for _, e := range parts {
+		if !p.wants(e.Name) {
+			continue
+		}
+		// Skip parts without a valid consensus interval.
+		if e.Left == chain.None || e.Right <= e.Left {
+			continue
+		}
+		byName[e.Name] = append(byName[e.Name], [2]int{e.Left, e.Right})
+	}
+	for name, iv := range byName {
+		pr := get(p.composite, name)
+		pr.n++
+		for _, e := range merge(iv) {
+			pr.add(e[0], e[1])
+		}
+	}
+	return nil
+}
+
+// merge returns the union of the intervals in iv.
+func merge(iv [][2]int) [][2]int {
+	sort.Sort(byLeft(iv))
+	m := iv[:1]
+	for _, e := range iv[1:] {
+		last := &m[len(m)-1]
+		if e[0] <= last[1] {
+			if e[1] > last[1] {
+				last[1] = e[1]
+			}
+			continue
+		}
+		m = append(m, e)
+	}
+	return m
+}
+
+// sets returns the profile sets of p in output order with their type.
+func (p profiles) sets() []struct {
+	typ      string
+	profiles map[string]*profile
+} {
+	return []struct {
+		typ      string
+		profiles map[string]*profile
+	}{
+		{typ: "simple", profiles: p.simple},
+		{typ: "composite", profiles: p.composite},
+	}
+}
+
+func sortedNames(m map[string]*profile) []string {
+	n := make([]string, 0, len(m))
+	for k := range m {
+		n = append(n, k)
+	}
+	sort.Strings(n)
+	return n
+}
+
+func (p profiles) writeTSV(w io.Writer) error {
+	_, err := fmt.Fprintln(w, "type\tname\tposition\tdepth\tfraction")
+	if err != nil {
+		return err
+	}
+	for _, s := range p.sets() {
+		for _, name := range sortedNames(s.profiles) {
+			pr := s.profiles[name]
+			for i, d := range pr.depth() {
+				_, err = fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%.4g\n",
+					s.typ, name, feat.ZeroToOne(i), d, float64(d)/float64(pr.n))
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (p profiles) writeBedGraph(w io.Writer) error {
+	for _, s := range p.sets() {
+		if len(s.profiles) == 0 {
+			continue
+		}
+		_, err := fmt.Fprintf(w, "track type=bedGraph name=%q description=%q\n",
+			s.typ, s.typ+" consensus coverage")
+		if err != nil {
+			return err
+		}
+		for _, name := range sortedNames(s.profiles) {
+			d := s.profiles[name].depth()
+			for start := 0; start < len(d); {
+				end := start + 1
+				for end < len(d) && d[end] == d[start] {
+					end++
+				}
+				_, err = fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", name, start, end, d[start])
+				if err != nil {
+					return err
+				}
+				start = end
+			}
+		}
+	}
+	return nil
+}
+
+type byLeft [][2]int
+
+func (p byLeft) Len() int           { return len(p) }
+func (p byLeft) Less(i, j int) bool { return p[i][0] < p[j][0] }
+func (p byLeft) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
@@ -0,0 +1,269 @@
+// Copyright ©2015 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// report writes a self-contained HTML quality control report for a quilt run.
+//
+// The report is built from the outputs of the pipeline stages, each given by a
+// flag: -converted for rm2gff or map2gff output, -stitch for stitch output,
+// -tailor for tailor output, -patch for patchwork output and -nest for the
+// GFF3 insertion nesting tree written by patchwork -nest. Sections of the
+// report that depend on a stage that is not given are omitted. The report holds
+// no references to external assets; all charts are inline SVG.
+//
+// The report covers:
+//
+//   - per-class parts merged, composites, condensation and discord of the
+//     stitch composites
+//   - the histogram of genomic gaps between consecutive parts of composites
+//   - the distribution of chain lengths, the number of parts in each composite
+//   - the number of bases annotated before stitching, by the converted
+//     features, and after stitching, by the parts of the stitch composites and
+//     the tailored simple repeats, and as a fraction of the genome if the
+//     -lengths file of tab separated sequence names and lengths is given
+//   - the -top patchwork composites with the most direct insertions, counted
+//     from their TinT attributes
+//   - the -top most deeply nested insertions in the nesting tree, with the
+//     chain of elements each is nested within
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/biogo/biogo/io/featio/gff"
+
+	"github.com/kortschak/quilt/genome"
+)
+
+var (
+	converted   = flag.String("converted", "", "Filename for converted repeat annotation.")
+	stitched    = flag.String("stitch", "", "Filename for stitch output.")
+	tailored    = flag.String("tailor", "", "Filename for tailor output.")
+	patched     = flag.String("patch", "", "Filename for patchwork output.")
+	nestFile    = flag.String("nest", "", "Filename for the patchwork GFF3 nesting tree.")
+	lengthsFile = flag.String("lengths", "", "Filename for tab separated sequence lengths.")
+	outFile     = flag.String("out", "", "Filename to write the report to (default stdout).")
+	title       = flag.String("title", "quilt report", "Title of the report.")
+	top         = flag.Int("top", 10, "Number of composites with the most insertions and of nested insertions to report.")
+	gapWidth    = flag.Int("gap-bin", 100, "Width of gap histogram bins.")
+	gapLimit    = flag.Int("gap-limit", 5000, "Maximum gap length shown in the gap histogram.")
+	help        = flag.Bool("help", false, "Print this usage message.")
+)
+
+func main() {
+	flag.Parse()
+	if *help || (*converted == "" && *stitched == "" && *tailored == "" && *patched == "" && *nestFile == "") {
+		flag.Usage()
+		os.Exit(0)
+	}
+	if *gapWidth < 1 || *gapLimit < 1 {
+		log.Fatal("gap bin width and limit must be positive")
+	}
+
+	r := report{
+		Title:   *title,
+		Date:    time.Now().Format(time.RFC1123),
+		Inputs:  inputs(),
+		gapBin:  *gapWidth,
+		gapLim:  *gapLimit,
+		classes: make(map[string]*classStats),
+		before:  make(genome.Intervals),
+		after:   make(genome.Intervals),
+	}
+
+	var err error
+	r.genome, err = genome.Length(*lengthsFile, "")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *converted != "" {
+		err = readFeatures(*converted, func(f *gff.Feature) error {
+			r.before.Add(f.SeqName, f.FeatStart, f.FeatEnd)
+			return nil
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *stitched != "" {
+		err = readFeatures(*stitched, func(f *gff.Feature) error {
+			if f.Source != "stitch" {
+				return nil
+			}
+			return r.addComposite(f)
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *tailored != "" {
+		err = readFeatures(*tailored, func(f *gff.Feature) error {
+			if f.FeatAttributes.Get("Repeat") != "" {
+				r.after.Add(f.SeqName, f.FeatStart, f.FeatEnd)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *patched != "" {
+		err = readFeatures(*patched, func(f *gff.Feature) error {
+			if f.Source != "patch" {
+				return nil
+			}
+			return r.addPatch(f)
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *nestFile != "" {
+		r.nested, err = readNest(*nestFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	r.build(*top)
+
+	out := os.Stdout
+	if *outFile != "" {
+		out, err = os.Create(*outFile)
+		if err != nil {
+			log.Fatalf("could not create %q: %v", *outFile, err)
+		}
+	}
+	err = page.Execute(out, r)
+	if err != nil {
+		log.Fatalf("failed to write report: %v", err)
+	}
+	if out != os.Stdout {
+		err = out.Close()
+		if err != nil {
+			log.Fatalf("failed to close %q: %v", *outFile, err)
+		}
+	}
+}
+
+// input is a named pipeline stage output.
+type input struct {
+	Stage, File string
+}
+
+func inputs() []input {
+	var in []input
+	for _, i := range []input{
+		{Stage: "converted", File: *converted},
+		{Stage: "stitch", File: *stitched},
+		{Stage: "tailor", File: *tailored},
+		{Stage: "patchwork", File: *patched},
+		{Stage: "nesting", File: *nestFile},
+		{Stage: "lengths", File: *lengthsFile},
+	} {
+		if i.File != "" {
+			in = append(in, i)
+		}
+	}
+	return in
+}
+
+// readFeatures calls fn for each feature in the named GFF file.
+func readFeatures(file string, fn func(*gff.Feature) error) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("could not open %q: %v", file, err)
+	}
+	defer f.Close()
+	fmt.Fprintf(os.Stderr, "reading repeat features from %q.\n", file)
+
+	in := gff.NewReader(f)
+	for {
+		f, err := in.Read()
+		if err != nil {
+			if err != io.EOF {
+				return fmt.Errorf("failed to read feature from %q: %v", file, err)
+			}
+			return nil
+		}
+		err = fn(f.(*gff.Feature))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readNest returns the insertions in the named GFF3 nesting tree written by
+// patchwork. Each element with a Parent attribute is returned with the chain
+// of elements it is nested within, outermost first.
+func readNest(file string) ([]nestedRow, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %q: %v", file, err)
+	}
+	defer f.Close()
+	fmt.Fprintf(os.Stderr, "reading nesting tree from %q.\n", file)
+
+	var (
+		rows  []nestedRow
+		hosts = make(map[string][]string)
+	)
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		b := bytes.TrimSpace(sc.Bytes())
+		if len(b) == 0 || b[0] == '#' {
+			continue
+		}
+		fields := strings.Split(string(b), "\t")
+		if len(fields) != 9 {
+			return nil, fmt.Errorf("unexpected number of fields on line %d of %q", line, file)
+		}
+		attr := make(map[string]string)
+		for _, a := range strings.Split(fields[8], ";") {
+			i := strings.IndexByte(a, '=')
+			if i < 0 {
+				return nil, fmt.Errorf("invalid attribute %q on line %d of %q", a, line, file)
+			}
+			attr[a[:i]], err = url.PathUnescape(a[i+1:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid attribute %q on line %d of %q: %v", a, line, file, err)
+			}
+		}
+		chrom, err := url.PathUnescape(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid sequence name on line %d of %q: %v", line, file, err)
+		}
+		location := fmt.Sprintf("%s:%s-%s(%s)", chrom, fields[3], fields[4], fields[6])
+
+		var within []string
+		if p, ok := attr["Parent"]; ok {
+			within, ok = hosts[p]
+			if !ok {
+				return nil, fmt.Errorf("unknown parent %q on line %d of %q", p, line, file)
+			}
+			rows = append(rows, nestedRow{
+				Location: location,
+				Name:     attr["Name"],
+				Class:    attr["Class"],
+				Depth:    len(within),
+				Hosts:    within,
+			})
+		}
+		if id, ok := attr["ID"]; ok {
+			hosts[id] = append(within[:len(within):len(within)], fmt.Sprintf("%s %s %s", attr["Name"], attr["Class"], location))
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %q: %v", file, err)
+	}
+	return rows, nil
+}
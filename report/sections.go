@@ -0,0 +1,286 @@
+// Copyright ©2015 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/biogo/biogo/feat"
+	"github.com/biogo/biogo/io/featio/gff"
+
+	"github.com/kortschak/quilt/chain"
+	"github.com/kortschak/quilt/genome"
+)
+
+// report holds the content of a report page.
+type report struct {
+	Title  string
+	Date   string
+	Inputs []input
+
+	Classes      []classRow
+	Totals       classRow
+	Condensation template.HTML
+	Discord      template.HTML
+
+	Gaps        template.HTML
+	Overlapping int
+	Links       int
+
+	ChainLengths template.HTML
+
+	Coverage      []coverageRow
+	CoverageChart template.HTML
+
+	Insertions []insertionRow
+	Nested     []nestedRow
+
+	gapBin, gapLim int
+	classes        map[string]*classStats
+	gaps           []int
+	chainLengths   []int
+
+	before, after genome.Intervals
+	genome        int
+
+	patches []insertionRow
+	nested  []nestedRow
+}
+
+// classStats counts the composites, parts and discordant composites
+// of a class.
+type classStats struct {
+	composites, parts, discords int
+}
+
+// classRow is the composite statistics of a class.
+type classRow struct {
+	Class        string
+	Parts        int
+	Composites   int
+	Condensation float64
+	Discords     int
+	DiscordFreq  float64
+}
+
+func newClassRow(class string, s classStats) classRow {
+	r := classRow{Class: class, Parts: s.parts, Composites: s.composites, Discords: s.discords}
+	if s.composites != 0 {
+		r.Condensation = float64(s.parts) / float64(s.composites)
+		r.DiscordFreq = float64(s.discords) / float64(s.composites)
+	}
+	return r
+}
+
+// coverageRow is the number of bases annotated at a pipeline stage.
+type coverageRow struct {
+	Stage    string
+	Bases    int
+	Fraction float64
+}
+
+// insertionRow describes a patchwork composite and its insertions.
+type insertionRow struct {
+	Location   string
+	Class      string
+	Count      int
+	Insertions []string
+}
+
+// nestedRow describes an insertion in the patchwork nesting tree and
+// the elements it is nested within, outermost first. Depth is the
+// number of elements it is nested within.
+type nestedRow struct {
+	Location string
+	Name     string
+	Class    string
+	Depth    int
+	Hosts    []string
+}
+
+// addComposite adds the stitch composite f to the class, gap and chain
+// length statistics of r, and adds its parts to the after stitching
+// coverage of r.
+func (r *report) addComposite(f *gff.Feature) error {
+	class, err := strconv.Unquote(f.FeatAttributes.Get("Class"))
+	if err != nil {
+		return fmt.Errorf("failed to unquote class: %v", err)
+	}
+	parts, err := chain.ParseParts(f.FeatAttributes.Get("Parts"), f.SeqName, f.FeatStrand)
+	if err != nil {
+		return err
+	}
+	s, ok := r.classes[class]
+	if !ok {
+		s = &classStats{}
+		r.classes[class] = s
+	}
+	s.composites++
+	s.parts += len(parts)
+	for _, p := range parts[1:] {
+		if p.Name != parts[0].Name {
+			s.discords++
+			break
+		}
+	}
+	r.chainLengths = append(r.chainLengths, len(parts))
+	for _, p := range parts {
+		r.after.Add(f.SeqName, p.Genomic.Left, p.Genomic.Right)
+	}
+
+	sort.Sort(byPartStart(parts))
+	for i, p := range parts[1:] {
+		r.gaps = append(r.gaps, p.Genomic.Left-parts[i].Genomic.Right)
+	}
+	return nil
+}
+
+// addPatch adds the insertions of the patchwork composite f to r.
+func (r *report) addPatch(f *gff.Feature) error {
+	class, err := strconv.Unquote(f.FeatAttributes.Get("Class"))
+	if err != nil {
+		return fmt.Errorf("failed to unquote class: %v", err)
+	}
+	tint := f.FeatAttributes.Get("TinT")
+	i := strings.IndexByte(tint, ' ')
+	if i < 0 {
+		return nil
+	}
+	n, err := strconv.Atoi(tint[:i])
+	if err != nil {
+		return fmt.Errorf("failed to parse insertion count: %v", err)
+	}
+	list, err := strconv.Unquote(tint[i+1:])
+	if err != nil {
+		return fmt.Errorf("failed to unquote insertions: %v", err)
+	}
+	r.patches = append(r.patches, insertionRow{
+		Location:   fmt.Sprintf("%s:%d-%d(%s)", f.SeqName, feat.ZeroToOne(f.FeatStart), f.FeatEnd, f.FeatStrand),
+		Class:      class,
+		Count:      n,
+		Insertions: strings.Split(list, "|"),
+	})
+	return nil
+}
+
+// build fills the exported fields of r from the collected statistics,
+// retaining the top composites with the most insertions and the top
+// most deeply nested insertions.
+func (r *report) build(top int) {
+	var (
+		names  []string
+		totals classStats
+	)
+	for c, s := range r.classes {
+		names = append(names, c)
+		totals.composites += s.composites
+		totals.parts += s.parts
+		totals.discords += s.discords
+	}
+	sort.Strings(names)
+	var cond, disc []float64
+	for _, c := range names {
+		row := newClassRow(c, *r.classes[c])
+		r.Classes = append(r.Classes, row)
+		cond = append(cond, row.Condensation)
+		disc = append(disc, row.DiscordFreq)
+	}
+	r.Totals = newClassRow("total", totals)
+	if len(names) != 0 {
+		r.Condensation = barChart("condensation (parts per composite)", names, cond, "%.2f")
+		r.Discord = barChart("discord frequency", names, disc, "%.3f")
+	}
+
+	r.Links = len(r.gaps)
+	if len(r.gaps) != 0 {
+		var gaps []int
+		for _, g := range r.gaps {
+			if g < 0 {
+				r.Overlapping++
+				continue
+			}
+			gaps = append(gaps, g)
+		}
+		r.Gaps = histogram("genomic gap between consecutive parts (bp)", gaps, r.gapBin, r.gapLim)
+	}
+	if len(r.chainLengths) != 0 {
+		max := 0
+		for _, l := range r.chainLengths {
+			if l > max {
+				max = l
+			}
+		}
+		r.ChainLengths = histogram("parts per composite", r.chainLengths, 1, max+1)
+	}
+
+	var (
+		stages []string
+		bases  []float64
+	)
+	for _, s := range []struct {
+		stage string
+		c     genome.Intervals
+		ok    bool
+	}{
+		{stage: "before stitching", c: r.before, ok: len(r.before) != 0},
+		{stage: "after stitching", c: r.after, ok: len(r.after) != 0},
+	} {
+		if !s.ok {
+			continue
+		}
+		row := coverageRow{Stage: s.stage, Bases: s.c.Bases()}
+		if r.genome != 0 {
+			row.Fraction = float64(row.Bases) / float64(r.genome)
+		}
+		r.Coverage = append(r.Coverage, row)
+		stages = append(stages, s.stage)
+		if r.genome != 0 {
+			bases = append(bases, row.Fraction)
+		} else {
+			bases = append(bases, float64(row.Bases))
+		}
+	}
+	if len(stages) != 0 {
+		if r.genome != 0 {
+			r.CoverageChart = barChart("fraction of genome annotated", stages, bases, "%.4f")
+		} else {
+			r.CoverageChart = barChart("bases annotated", stages, bases, "%.0f")
+		}
+	}
+
+	sort.Stable(byInsertions(r.patches))
+	if len(r.patches) > top {
+		r.patches = r.patches[:top]
+	}
+	r.Insertions = r.patches
+
+	sort.Stable(byDepth(r.nested))
+	if len(r.nested) > top {
+		r.nested = r.nested[:top]
+	}
+	r.Nested = r.nested
+}
+
+type byPartStart chain.Parts
+
+func (p byPartStart) Len() int           { return len(p) }
+func (p byPartStart) Less(i, j int) bool { return p[i].Genomic.Left < p[j].Genomic.Left }
+func (p byPartStart) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+type byInsertions []insertionRow
+
+func (r byInsertions) Len() int           { return len(r) }
+func (r byInsertions) Less(i, j int) bool { return r[i].Count > r[j].Count }
+func (r byInsertions) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+type byDepth []nestedRow
+
+func (r byDepth) Len() int           { return len(r) }
+func (r byDepth) Less(i, j int) bool { return r[i].Depth > r[j].Depth }
+func (r byDepth) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
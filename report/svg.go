@@ -0,0 +1,165 @@
+// Copyright ©2015 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+)
+
+// Chart dimensions.
+const (
+	chartWidth  = 600
+	barHeight   = 18
+	labelWidth  = 160
+	plotHeight  = 200
+	chartMargin = 30
+)
+
+// barChart returns an inline SVG horizontal bar chart of values with the
+// given labels. Values are printed at the end of each bar using format.
+func barChart(title string, labels []string, values []float64, format string) template.HTML {
+	max := 0.0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	height := len(labels)*barHeight + 2*chartMargin
+	plot := float64(chartWidth - labelWidth - 2*chartMargin)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="11">
+<text x="%d" y="%d" font-weight="bold">%s</text>
+`, chartWidth, height, chartMargin, chartMargin-10, html.EscapeString(title))
+	for i, l := range labels {
+		y := chartMargin + i*barHeight
+		var w float64
+		if max > 0 {
+			w = plot * values[i] / max
+		}
+		fmt.Fprintf(&buf, `<text x="%d" y="%d" text-anchor="end">%s</text>
+<rect x="%d" y="%d" width="%.2f" height="%d" fill="steelblue"/>
+<text x="%.2f" y="%d">%s</text>
+`,
+			labelWidth-5, y+barHeight-5, html.EscapeString(l),
+			labelWidth, y+2, w, barHeight-4,
+			float64(labelWidth)+w+3, y+barHeight-5, fmt.Sprintf(format, values[i]),
+		)
+	}
+	buf.WriteString("</svg>")
+	return template.HTML(buf.String())
+}
+
+// histogram returns an inline SVG histogram of v with bins of the given
+// width over [0, limit). Values of limit or more are counted in the last
+// bin.
+func histogram(title string, v []int, width, limit int) template.HTML {
+	n := (limit + width - 1) / width
+	counts := make([]int, n)
+	for _, e := range v {
+		b := e / width
+		if b >= n {
+			b = n - 1
+		}
+		counts[b]++
+	}
+	max := 0
+	for _, c := range counts {
+		if c > max {
+			max = c
+		}
+	}
+
+	height := plotHeight + 2*chartMargin
+	plot := float64(chartWidth - 2*chartMargin)
+	bw := plot / float64(n)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="11">
+<text x="%d" y="%d" font-weight="bold">%s (n=%d)</text>
+<rect x="%d" y="%d" width="%.0f" height="%d" fill="none" stroke="black"/>
+`, chartWidth, height, chartMargin, chartMargin-10, html.EscapeString(title), len(v),
+		chartMargin, chartMargin, plot, plotHeight)
+	for b, c := range counts {
+		if c == 0 {
+			continue
+		}
+		h := float64(plotHeight) * float64(c) / float64(max)
+		fmt.Fprintf(&buf, `<rect x="%.2f" y="%.2f" width="%.2f" height="%.2f" fill="steelblue"><title>%d-%d: %d</title></rect>
+`, float64(chartMargin)+float64(b)*bw, float64(chartMargin+plotHeight)-h, bw, h, b*width, (b+1)*width-1, c)
+	}
+	fmt.Fprintf(&buf, `<text x="%d" y="%d">0</text>
+<text x="%d" y="%d" text-anchor="end">%d+</text>
+<text x="%d" y="%d" text-anchor="end">%d</text>
+</svg>`,
+		chartMargin, chartMargin+plotHeight+14,
+		chartWidth-chartMargin, chartMargin+plotHeight+14, (n-1)*width,
+		chartMargin-3, chartMargin+10, max,
+	)
+	return template.HTML(buf.String())
+}
+
+var page = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 2px 8px; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+tr.total { font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>Generated {{.Date}}.</p>
+<table>
+<tr><th>stage</th><th>file</th></tr>
+{{range .Inputs}}<tr><td>{{.Stage}}</td><td>{{.File}}</td></tr>
+{{end}}</table>
+{{if .Classes}}
+<h2>Composites by class</h2>
+<table>
+<tr><th>class</th><th>parts merged</th><th>composites</th><th>condensation</th><th>discord count</th><th>discord freq</th></tr>
+{{range .Classes}}<tr><td>{{.Class}}</td><td>{{.Parts}}</td><td>{{.Composites}}</td><td>{{printf "%.2f" .Condensation}}</td><td>{{.Discords}}</td><td>{{printf "%.3f" .DiscordFreq}}</td></tr>
+{{end}}{{with .Totals}}<tr class="total"><td>{{.Class}}</td><td>{{.Parts}}</td><td>{{.Composites}}</td><td>{{printf "%.2f" .Condensation}}</td><td>{{.Discords}}</td><td>{{printf "%.3f" .DiscordFreq}}</td></tr>{{end}}
+</table>
+<div>{{.Condensation}}</div>
+<div>{{.Discord}}</div>
+{{end}}{{if .Gaps}}
+<h2>Gaps between parts</h2>
+<p>{{.Links}} links between consecutive parts, {{.Overlapping}} of which overlap and are not shown.</p>
+<div>{{.Gaps}}</div>
+{{end}}{{if .ChainLengths}}
+<h2>Chain lengths</h2>
+<div>{{.ChainLengths}}</div>
+{{end}}{{if .Coverage}}
+<h2>Genome annotated</h2>
+<table>
+<tr><th>stage</th><th>bases</th><th>fraction</th></tr>
+{{range .Coverage}}<tr><td>{{.Stage}}</td><td>{{.Bases}}</td><td>{{if .Fraction}}{{printf "%.4f" .Fraction}}{{else}}.{{end}}</td></tr>
+{{end}}</table>
+<div>{{.CoverageChart}}</div>
+{{end}}{{if .Insertions}}
+<h2>Composites with the most insertions</h2>
+<table>
+<tr><th>location</th><th>class</th><th>insertions</th><th>inserted</th></tr>
+{{range .Insertions}}<tr><td>{{.Location}}</td><td>{{.Class}}</td><td>{{.Count}}</td><td style="text-align: left">{{range $i, $e := .Insertions}}{{if $i}}<br>{{end}}{{$e}}{{end}}</td></tr>
+{{end}}</table>
+{{end}}{{if .Nested}}
+<h2>Most deeply nested insertions</h2>
+<table>
+<tr><th>location</th><th>name</th><th>class</th><th>depth</th><th>nested within</th></tr>
+{{range .Nested}}<tr><td>{{.Location}}</td><td>{{.Name}}</td><td>{{.Class}}</td><td>{{.Depth}}</td><td style="text-align: left">{{range $i, $e := .Hosts}}{{if $i}}<br>{{end}}{{$e}}{{end}}</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
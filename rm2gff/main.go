@@ -3,6 +3,11 @@
 // license that can be found in the LICENSE file.
 
 // rm2gff converts RM out files to GFF including the stitch-required Repeat attribute.
+// The RM ID field is retained in the RMID attribute so that chained features can
+// be traced back to the original RM records, and the RM percent divergence from
+// the consensus is retained in the Div attribute. When the -mark-other flag is set,
+// features that RM marks as overlapped by a higher scoring match are given an
+// OtherMatch attribute.
 package main
 
 import (
@@ -50,7 +55,7 @@ func main() {
 		Source:         "RepeatMasker",
 		Feature:        "repeat",
 		FeatFrame:      gff.NoFrame,
-		FeatAttributes: gff.Attributes{{Tag: "Repeat"}},
+		FeatAttributes: gff.Attributes{{Tag: "Repeat"}, {Tag: "RMID"}, {Tag: "Div"}},
 	}
 	if *otherMatchAttribute {
 		f.FeatAttributes = append(f.FeatAttributes, gff.Attribute{Tag: "OtherMatch", Value: "yes"})
@@ -120,10 +125,12 @@ func fill(f *gff.Feature, data []string, markOther bool) (err error) {
 	f.FeatEnd = mustAtoi(data[queryEndField])
 	f.FeatStrand = mustRMtoSane(data[strandField])
 	f.FeatAttributes[0].Value = repeatAttribute(data)
+	f.FeatAttributes[1].Value = strconv.Itoa(mustAtoi(data[idField]))
+	f.FeatAttributes[2].Value = strconv.FormatFloat(*mustAtofp(data[fracDivergeField]), 'f', -1, 64)
 	if markOther && len(data) == numberOfFields && data[otherMatchField] == "*" {
-		f.FeatAttributes = f.FeatAttributes[:2]
+		f.FeatAttributes = f.FeatAttributes[:4]
 	} else {
-		f.FeatAttributes = f.FeatAttributes[:1]
+		f.FeatAttributes = f.FeatAttributes[:3]
 	}
 	return
 }
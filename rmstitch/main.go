@@ -5,15 +5,30 @@
 // rmstitch performs repeat annotation chaining on RM out data using the repeat
 // id field to identify chainable features.
 //
+// RM out data is read from the files named on the command line, or from stdin
+// if no files are given. Features are grouped by out file, query sequence and
+// RM ID, so IDs may appear in any order and the IDs of separate RM runs do not
+// collide. This allows genome-wide chain sets to be built from batched or
+// per-chromosome RM runs.
+//
 // The output of rmstitch is the same format as the output of stitch and is
 // intended to be used as a comparison between stitch and the RM repeat chains.
+// The score of each chain is the sum of the scores of its parts unless the
+// -rescore flag is set, in which case the chain is given the score that the
+// stitch cost model would assign it. Chains that the stitch cost model cannot
+// join are given no score. Each chain is given the mean RM percent divergence of
+// its parts, weighted by part length, in its Div attribute. With -format bed,
+// chains are written as BED12 with one block per part.
 package main
 
 import (
 	"bufio"
 	"bytes"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"os"
 	"sort"
 	"strconv"
@@ -22,6 +37,9 @@ import (
 	"github.com/biogo/biogo/feat"
 	"github.com/biogo/biogo/io/featio/gff"
 	"github.com/biogo/biogo/seq"
+
+	"github.com/kortschak/quilt/bed"
+	"github.com/kortschak/quilt/chain"
 )
 
 const firstDataLine = 4
@@ -47,65 +65,189 @@ const (
 	numberOfFields
 )
 
+var (
+	rescore = flag.Bool("rescore", false, "score chains with the stitch cost model instead of summing part scores")
+	format  = flag.String("format", "gff", "output format: gff or bed")
+)
+
 func main() {
-	groups := [][]*gff.Feature{nil} // Gain one-based index for this case.
-	sc := bufio.NewScanner(os.Stdin)
-	for n := 1; sc.Scan(); n++ {
-		if n < firstDataLine {
-			continue
-		}
-		f := &gff.Feature{
-			Source:         "RepeatMasker",
-			Feature:        "repeat",
-			FeatFrame:      gff.NoFrame,
-			FeatAttributes: gff.Attributes{{Tag: "Repeat"}, {Tag: "ID"}},
-		}
-		data := strings.Fields(sc.Text())
-		err := fill(f, data)
+	flag.Parse()
+	switch *format {
+	case "gff", "bed":
+	default:
+		log.Fatalf("unknown output format: %q", *format)
+	}
+
+	groups := make(map[group][]*gff.Feature)
+	if len(flag.Args()) == 0 {
+		err := readGroups(os.Stdin, "stdin", groups)
 		if err != nil {
-			log.Fatalf("parse error on line %d: %v", n, err)
+			log.Fatal(err)
 		}
-		id, err := strconv.Atoi(data[idField])
+	}
+	for _, file := range flag.Args() {
+		f, err := os.Open(file)
 		if err != nil {
-			log.Fatalf("id parse error on line %d: %v", n, err)
+			log.Fatalf("could not open %q: %v", file, err)
 		}
-		f.FeatAttributes[1].Value = fmt.Sprint(id)
-		switch {
-		case id == len(groups):
-			groups = append(groups, []*gff.Feature{f})
-		case id < len(groups):
-			groups[id] = append(groups[id], f)
-		default:
-			log.Fatalf("id out of order: expect <= %d got %d", len(groups), id)
+		fmt.Fprintf(os.Stderr, "reading repeat features from %q\n", file)
+		err = readGroups(f, file, groups)
+		f.Close()
+		if err != nil {
+			log.Fatal(err)
 		}
 	}
-	err := sc.Err()
-	if err != nil {
-		log.Fatal(err)
-	}
 
-	w := gff.NewWriter(os.Stdout, 60, true)
+	var chains [][]*gff.Feature
 	for _, g := range groups {
 		if len(g) < 2 {
 			continue
 		}
 		sort.Sort(byGenomeLocation(g))
+		chains = append(chains, g)
+	}
+	sort.Sort(byChainLocation(chains))
+
+	var (
+		unscored int
+		err      error
+	)
+	gw := gff.NewWriter(os.Stdout, 60, *format == "gff")
+	bw := bed.NewWriter(os.Stdout)
+	for _, g := range chains {
 		right := g[0].FeatEnd
 		for _, p := range g[1:] {
 			if p.FeatEnd > right {
 				right = p.FeatEnd
 			}
 		}
-		w.Write(&gff.Feature{
-			Source:         "stitch",
-			Feature:        "composite",
-			SeqName:        g[0].SeqName,
-			FeatStart:      g[0].FeatStart,
-			FeatEnd:        right,
+		var score float64
+		if *rescore {
+			score = chainScore(g)
+			if math.IsNaN(score) {
+				unscored++
+			}
+		} else {
+			for _, p := range g {
+				score += *p.FeatScore
+			}
+		}
+		switch *format {
+		case "gff":
+			_, err = gw.Write(&gff.Feature{
+				Source:         "stitch",
+				Feature:        "composite",
+				SeqName:        g[0].SeqName,
+				FeatStart:      g[0].FeatStart,
+				FeatEnd:        right,
+				FeatScore:      &score,
+				FeatStrand:     strand(g),
+				FeatFrame:      gff.NoFrame,
+				FeatAttributes: attributes(g),
+			})
+		case "bed":
+			err = bw.Write(bedRecord(g, score))
+		}
+		if err != nil {
+			log.Fatalf("failed to write composite: %v", err)
+		}
+	}
+	if unscored != 0 {
+		log.Printf("%d chains could not be scored by the stitch cost model", unscored)
+	}
+}
+
+// bedRecord returns a BED12 record for the chain g with a block for
+// each part, named by class and the name of the first part.
+func bedRecord(g []*gff.Feature, score float64) bed.Record {
+	f := strings.Fields(g[0].FeatAttributes.Get("Repeat"))
+	blocks := make([]bed.Block, len(g))
+	for i, p := range g {
+		blocks[i] = bed.Block{Start: p.FeatStart, End: p.FeatEnd}
+	}
+	return bed.Record{
+		Chrom:  g[0].SeqName,
+		Name:   f[1] + "/" + f[0],
+		Class:  f[1],
+		Score:  score,
+		Strand: strand(g),
+		Blocks: blocks,
+	}
+}
+
+// strand returns the strand shared by all the features in g, or
+// seq.None if the features are not all on the same strand.
+func strand(g []*gff.Feature) seq.Strand {
+	s := g[0].FeatStrand
+	for _, p := range g[1:] {
+		if p.FeatStrand != s {
+			return seq.None
+		}
+	}
+	return s
+}
+
+// group identifies a set of chainable RM records. RM IDs are only
+// unique within a single out file, so the file name is included.
+type group struct {
+	file  string
+	chrom string
+	id    int
+}
+
+// chainScore returns the score that stitch would assign to the chain
+// of features in g. If any link in the chain cannot be made by stitch,
+// chainScore returns NaN.
+func chainScore(g []*gff.Feature) float64 {
+	links := make([]*chain.Simple, len(g))
+	for i, f := range g {
+		r, err := chain.NewSimple(f)
+		if err != nil {
+			return math.NaN()
+		}
+		links[i] = r
+	}
+	sort.Sort(chain.ByRightEnd(links))
+
+	score := links[0].Score
+	for i, right := range links[1:] {
+		s, ok := chain.Cost(links[i], right)
+		if !ok {
+			return math.NaN()
+		}
+		score += s
+	}
+	return score
+}
+
+// readGroups reads RM out records from r, adding them to groups. The
+// file parameter is used to distinguish IDs from different out files.
+func readGroups(r io.Reader, file string, groups map[group][]*gff.Feature) error {
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		if n < firstDataLine {
+			continue
+		}
+		f := &gff.Feature{
+			Source:         "RepeatMasker",
+			Feature:        "repeat",
 			FeatFrame:      gff.NoFrame,
-			FeatAttributes: attributes(g),
-		})
+			FeatAttributes: gff.Attributes{{Tag: "Repeat"}, {Tag: "RMID"}, {Tag: "Div"}},
+		}
+		data := strings.Fields(sc.Text())
+		err := fill(f, data)
+		if err != nil {
+			return fmt.Errorf("parse error on line %d of %s: %v", n, file, err)
+		}
+		id, err := strconv.Atoi(data[idField])
+		if err != nil {
+			return fmt.Errorf("id parse error on line %d of %s: %v", n, file, err)
+		}
+		f.FeatAttributes[1].Value = fmt.Sprint(id)
+		g := group{file: file, chrom: f.SeqName, id: id}
+		groups[g] = append(groups[g], f)
 	}
+	return sc.Err()
 }
 
 func handlePanic(err *error) {
@@ -155,6 +297,7 @@ func fill(f *gff.Feature, data []string) (err error) {
 	f.FeatEnd = mustAtoi(data[queryEndField])
 	f.FeatStrand = mustRMtoSane(data[strandField])
 	f.FeatAttributes[0].Value = repeatAttribute(data)
+	f.FeatAttributes[2].Value = strconv.FormatFloat(*mustAtofp(data[fracDivergeField]), 'f', -1, 64)
 	return
 }
 
@@ -185,6 +328,16 @@ func (g byGenomeLocation) Less(i, j int) bool {
 }
 func (g byGenomeLocation) Swap(i, j int) { g[i], g[j] = g[j], g[i] }
 
+type byChainLocation [][]*gff.Feature
+
+func (c byChainLocation) Len() int { return len(c) }
+func (c byChainLocation) Less(i, j int) bool {
+	iName := c[i][0].SeqName
+	jName := c[j][0].SeqName
+	return iName < jName || (iName == jName && c[i][0].FeatStart < c[j][0].FeatStart)
+}
+func (c byChainLocation) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+
 func attributes(p []*gff.Feature) gff.Attributes {
 	var (
 		buf   bytes.Buffer
@@ -206,9 +359,18 @@ func attributes(p []*gff.Feature) gff.Attributes {
 		)
 	}
 	buf.WriteByte('"')
+
+	ids := make([]string, len(p))
+	var div, length float64
+	for i, e := range p {
+		ids[i] = e.FeatAttributes.Get("RMID")
+		div += *mustAtofp(e.FeatAttributes.Get("Div")) * float64(e.Len())
+		length += float64(e.Len())
+	}
 	return gff.Attributes{
 		{Tag: "Class", Value: `"` + class + `"`},
 		{Tag: "Parts", Value: buf.String()},
-		{Tag: "ID", Value: p[0].FeatAttributes.Get("ID")},
+		{Tag: "RMID", Value: `"` + strings.Join(ids, "|") + `"`},
+		{Tag: "Div", Value: strconv.FormatFloat(div/length, 'f', 2, 64)},
 	}
 }
@@ -0,0 +1,64 @@
+// Copyright ©2015 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/biogo/biogo/feat"
+
+	"github.com/kortschak/quilt/chain"
+	"github.com/kortschak/quilt/gff3"
+)
+
+// writeGFF3 writes the composites in all to w as GFF3. Each composite is
+// given an ID and its parts are written as child features referring to
+// the composite with a Parent attribute. The consensus coordinates of each
+// part are given by its Target attribute.
+func writeGFF3(w io.Writer, all []chain.Composite) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "##gff-version 3")
+	for i, c := range all {
+		id := fmt.Sprintf("composite%d", i+1)
+		chrom := gff3.Escape(c.Parts[0].Genomic.Chrom, false)
+		strand := c.Parts[0].Genomic.Strand
+		fmt.Fprintf(bw, "%s\tstitch\tcomposite\t%d\t%d\t%s\t%s\t.\tID=%s;Name=%s;Class=%s",
+			chrom,
+			feat.ZeroToOne(c.Parts[0].Genomic.Left), c.End(),
+			strconv.FormatFloat(c.Score, 'g', -1, 64), strand,
+			id, gff3.Escape(c.Parts[0].Name, true), gff3.Escape(c.Class, true),
+		)
+		if div, ok := c.Divergence(); ok {
+			fmt.Fprintf(bw, ";Div=%s", strconv.FormatFloat(div, 'f', 2, 64))
+		}
+		bw.WriteByte('\n')
+		for j, p := range c.Parts {
+			fmt.Fprintf(bw, "%s\tstitch\tpart\t%d\t%d\t.\t%s\t.\tID=%s.%d;Parent=%s;Name=%s",
+				chrom,
+				feat.ZeroToOne(p.Genomic.Left), p.Genomic.Right,
+				p.Genomic.Strand,
+				id, j+1, id, gff3.Escape(p.Name, true),
+			)
+			if p.Left != chain.None && p.Right != chain.None {
+				fmt.Fprintf(bw, ";Target=%s %d %d +",
+					strings.Replace(gff3.Escape(p.Name, true), " ", "%20", -1),
+					feat.ZeroToOne(p.Left), p.Right,
+				)
+			}
+			if p.ID != "" {
+				fmt.Fprintf(bw, ";RMID=%s", gff3.Escape(p.ID, true))
+			}
+			if p.Div != chain.None {
+				fmt.Fprintf(bw, ";Div=%s", strconv.FormatFloat(p.Div, 'f', -1, 64))
+			}
+			bw.WriteByte('\n')
+		}
+	}
+	return bw.Flush()
+}
@@ -21,6 +21,20 @@
 // the cost function must be be outweighed by the score gained by including the
 // chain prefix.
 //
+// If the input features carry an RMID attribute, as written by rm2gff, the IDs of
+// the parts of each composite are retained in the RMID attribute of the composite
+// in the same order as the parts. Features marked with the OtherMatch attribute by
+// rm2gff -mark-other may be excluded from chaining or have their score down-weighted.
+// If the input features carry a Div attribute, each composite is given the mean
+// divergence of its parts, weighted by part length, in its Div attribute. Parts
+// without a Div attribute are not included in the mean, and composites with no
+// such parts are given no Div attribute and are counted in the log.
+//
+// By default composites are written as GFF2 with the parts held in a quoted Parts
+// attribute. With -format gff3, each composite is written as a GFF3 feature with
+// an ID and each part is written as a child feature with a Parent attribute and a
+// Target attribute giving the consensus coordinates of the part. With -format bed,
+// composites are written as BED12 with one block per part.
 package main
 
 import (
@@ -31,13 +45,21 @@ import (
 	"os"
 	"runtime"
 	"sort"
+	"strconv"
 
 	"github.com/biogo/biogo/io/featio/gff"
+
+	"github.com/kortschak/quilt/bed"
+	"github.com/kortschak/quilt/chain"
 )
 
 var (
 	inFile  = flag.String("in", "", "filename of a GFF file containing repeat annotations")
 	workers = flag.Int("workers", 0, "number of parallel workers to use for stitching repeats (if 0 use GOMAXPROCS)")
+	format  = flag.String("format", "gff", "output format: gff, gff3 or bed")
+
+	excludeOther = flag.Bool("exclude-other", false, "exclude features marked with OtherMatch from chaining")
+	otherWeight  = flag.Float64("other-weight", 1, "score weight applied to features marked with OtherMatch")
 )
 
 func main() {
@@ -49,6 +71,15 @@ func main() {
 	if *workers == 0 {
 		*workers = runtime.GOMAXPROCS(0)
 	}
+	// Written to reject NaN.
+	if !(*otherWeight >= 0) {
+		log.Fatal("OtherMatch score weight must not be negative")
+	}
+	switch *format {
+	case "gff", "gff3", "bed":
+	default:
+		log.Fatalf("unknown output format: %q", *format)
+	}
 
 	f, err := os.Open(*inFile)
 	if err != nil {
@@ -58,7 +89,7 @@ func main() {
 	defer f.Close()
 	in := gff.NewReader(f)
 
-	classes := make(map[partition][]*simple)
+	classes := make(map[partition][]*chain.Simple)
 	for {
 		f, err := in.Read()
 		if err != nil {
@@ -69,14 +100,20 @@ func main() {
 		}
 
 		gf := f.(*gff.Feature)
-		r, err := newSimpleRepeat(gf)
+		r, err := chain.NewSimple(gf)
 		if err != nil {
 			log.Fatal(err)
 		}
+		if r.OtherMatch {
+			if *excludeOther {
+				continue
+			}
+			r.Score *= *otherWeight
+		}
 		p := partition{
 			chrom:  gf.SeqName,
 			strand: gf.FeatStrand,
-			class:  r.class,
+			class:  r.Class,
 		}
 		classes[p] = append(classes[p], r)
 	}
@@ -86,38 +123,91 @@ func main() {
 	// elements to be included in the same analysis block.
 	const maxSeparation = 5e4
 
-	var all []composite
+	var all []chain.Composite
 	for c := range compositesFrom(classes, maxSeparation, *workers) {
 		all = append(all, c...)
 	}
 	log.Println("chaining complete.")
+	var noDiv int
+	for _, c := range all {
+		if _, ok := c.Divergence(); !ok {
+			noDiv++
+		}
+	}
+	if noDiv != 0 {
+		log.Printf("%d of %d composites without divergence", noDiv, len(all))
+	}
 
 	sort.Sort(byGenomeLocation(all))
-	w := gff.NewWriter(os.Stdout, 60, true)
+	switch *format {
+	case "gff":
+		err = writeGFF(os.Stdout, all)
+	case "gff3":
+		err = writeGFF3(os.Stdout, all)
+	case "bed":
+		err = writeBED(os.Stdout, all)
+	}
+	if err != nil {
+		log.Fatalf("failed to write composites: %v", err)
+	}
+}
+
+// writeGFF writes the composites in all to w as GFF2 with the parts
+// of each composite held in the Parts attribute.
+func writeGFF(w io.Writer, all []chain.Composite) error {
+	gw := gff.NewWriter(w, 60, true)
 	gf := &gff.Feature{
 		Source:    "stitch",
 		Feature:   "composite",
 		FeatFrame: gff.NoFrame,
 	}
 	for _, c := range all {
-		right := c.parts[0].genomic.right
-		for _, p := range c.parts[1:] {
-			if p.genomic.right > right {
-				right = p.genomic.right
-			}
-		}
-		gf.SeqName = c.parts[0].genomic.chrom
-		gf.FeatStart = c.parts[0].genomic.left
-		gf.FeatEnd = right
-		score := c.score
+		gf.SeqName = c.Parts[0].Genomic.Chrom
+		gf.FeatStart = c.Parts[0].Genomic.Left
+		gf.FeatEnd = c.End()
+		score := c.Score
 		gf.FeatScore = &score
-		gf.FeatStrand = c.parts[0].genomic.strand
+		gf.FeatStrand = c.Parts[0].Genomic.Strand
 
 		gf.FeatAttributes = gff.Attributes{
-			{Tag: "Class", Value: `"` + c.class + `"`},
-			{Tag: "Parts", Value: c.parts.String()},
+			{Tag: "Class", Value: `"` + c.Class + `"`},
+			{Tag: "Parts", Value: c.Parts.String()},
+		}
+		if ids, ok := c.Parts.IDs(); ok {
+			gf.FeatAttributes = append(gf.FeatAttributes, gff.Attribute{Tag: "RMID", Value: ids})
+		}
+		if div, ok := c.Divergence(); ok {
+			gf.FeatAttributes = append(gf.FeatAttributes, gff.Attribute{Tag: "Div", Value: strconv.FormatFloat(div, 'f', 2, 64)})
+		}
+
+		_, err := gw.Write(gf)
+		if err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		w.Write(gf)
+// writeBED writes the composites in all to w as BED12 with a block for
+// each part, named by class and the name of the first part.
+func writeBED(w io.Writer, all []chain.Composite) error {
+	bw := bed.NewWriter(w)
+	for _, c := range all {
+		blocks := make([]bed.Block, len(c.Parts))
+		for i, p := range c.Parts {
+			blocks[i] = bed.Block{Start: p.Genomic.Left, End: p.Genomic.Right}
+		}
+		err := bw.Write(bed.Record{
+			Chrom:  c.Parts[0].Genomic.Chrom,
+			Name:   c.Class + "/" + c.Parts[0].Name,
+			Class:  c.Class,
+			Score:  c.Score,
+			Strand: c.Parts[0].Genomic.Strand,
+			Blocks: blocks,
+		})
+		if err != nil {
+			return err
+		}
 	}
+	return nil
 }
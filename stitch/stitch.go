@@ -5,22 +5,19 @@
 package main
 
 import (
-	"bytes"
 	"fmt"
 	"log"
 	"os"
 	"sort"
-	"strconv"
-	"strings"
 	"sync"
 
-	"github.com/biogo/biogo/feat"
-	"github.com/biogo/biogo/io/featio/gff"
 	"github.com/biogo/biogo/seq"
+
+	"github.com/kortschak/quilt/chain"
 )
 
-func compositesFrom(parts map[partition][]*simple, maxSeparation, workers int) <-chan []composite {
-	done := make(chan []composite)
+func compositesFrom(parts map[partition][]*chain.Simple, maxSeparation, workers int) <-chan []chain.Composite {
+	done := make(chan []chain.Composite)
 	limit := make(chan struct{}, workers)
 	var wg sync.WaitGroup
 	go func() {
@@ -34,16 +31,16 @@ func compositesFrom(parts map[partition][]*simple, maxSeparation, workers int) <
 					wg.Done()
 				}()
 
-				if len(recs) < 2 || recs[0].left == none {
+				if len(recs) < 2 || recs[0].Left == chain.None {
 					log.Printf("%v records=%d - skip", p, len(recs))
 					return
 				}
 
-				sort.Sort(byRightEnd(recs))
+				sort.Sort(chain.ByRightEnd(recs))
 
 				var splits int
 				for i, r := range recs[1:] {
-					if r.genomic.right-recs[i].genomic.right > maxSeparation {
+					if r.Genomic.Right-recs[i].Genomic.Right > maxSeparation {
 						splits++
 					}
 				}
@@ -51,16 +48,16 @@ func compositesFrom(parts map[partition][]*simple, maxSeparation, workers int) <
 
 				i := 0
 				for j, r := range recs[1:] {
-					if r.genomic.right-recs[j].genomic.right > maxSeparation || j == len(recs)-2 {
+					if r.Genomic.Right-recs[j].Genomic.Right > maxSeparation || j == len(recs)-2 {
 						n := (j + 2) - i
 						if n < 2 {
 							continue
 						}
 						if workers == 1 {
 							fmt.Fprintf(os.Stderr, "split size:%d from(right end):%d to:%d\n",
-								n, recs[i].genomic.right, recs[j+1].genomic.right)
+								n, recs[i].Genomic.Right, recs[j+1].Genomic.Right)
 						}
-						c := stitch(recs[i:j+2], costFunction)
+						c := stitch(recs[i:j+2], chain.Cost)
 						i = j + 2
 
 						if workers == 1 {
@@ -82,7 +79,7 @@ func compositesFrom(parts map[partition][]*simple, maxSeparation, workers int) <
 	return done
 }
 
-func stitch(repeats []*simple, cost func(left, right *simple) (score float64, ok bool)) []composite {
+func stitch(repeats []*chain.Simple, cost func(left, right *chain.Simple) (score float64, ok bool)) []chain.Composite {
 	if len(repeats) < 2 {
 		return nil
 	}
@@ -93,7 +90,7 @@ func stitch(repeats []*simple, cost func(left, right *simple) (score float64, ok
 		a[i] = make([]element, len(repeats))
 	}
 	for i, r := range repeats {
-		a[0][i] = element{link: i, score: r.score}
+		a[0][i] = element{link: i, score: r.Score}
 	}
 	a[1][0].score = a[0][0].score
 
@@ -106,7 +103,7 @@ func stitch(repeats []*simple, cost func(left, right *simple) (score float64, ok
 		}
 	}
 
-	var cmp []composite
+	var cmp []chain.Composite
 
 	// Recover the highest scoring chains in descending order of
 	// chain score, not reusing any segments between chains.
@@ -125,42 +122,32 @@ func stitch(repeats []*simple, cost func(left, right *simple) (score float64, ok
 			continue
 		}
 		var (
-			c composite
+			c chain.Composite
 			p int
 		)
-		c.score = final[i].score
-		c.class = repeats[0].class
+		c.Score = final[i].score
+		c.Class = repeats[0].Class
 		for p = i; p != final[p].link; p = final[p].link {
 			if wasUsed[p] {
 				break
 			}
 			wasUsed[p] = true
-			c.parts = append(c.parts, part{
-				name:    repeats[p].name,
-				left:    repeats[p].left,
-				right:   repeats[p].right,
-				genomic: repeats[p].genomic,
-			})
+			c.Parts = append(c.Parts, chain.NewPart(repeats[p]))
 
 		}
 		if p == i {
 			continue
 		}
-		c.parts = append(c.parts, part{
-			name:    repeats[p].name,
-			left:    repeats[p].left,
-			right:   repeats[p].right,
-			genomic: repeats[p].genomic,
-		})
+		c.Parts = append(c.Parts, chain.NewPart(repeats[p]))
 
-		reverse(c.parts)
+		reverse(c.Parts)
 		cmp = append(cmp, c)
 	}
 
 	return cmp
 }
 
-func max(repeats []*simple, a [][]element, i, j int, fn func(left, right *simple) (score float64, ok bool)) element {
+func max(repeats []*chain.Simple, a [][]element, i, j int, fn func(left, right *chain.Simple) (score float64, ok bool)) element {
 	e := a[i-1][j]
 	right := repeats[j]
 	for k := j - 1; k >= 0; k-- {
@@ -178,7 +165,7 @@ func max(repeats []*simple, a [][]element, i, j int, fn func(left, right *simple
 	return e
 }
 
-func reverse(s []part) {
+func reverse(s []chain.Part) {
 	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
 		s[i], s[j] = s[j], s[i]
 	}
@@ -189,12 +176,6 @@ type element struct {
 	score float64
 }
 
-type composite struct {
-	class string
-	score float64
-	parts parts
-}
-
 type partition struct {
 	chrom  string
 	strand seq.Strand
@@ -205,129 +186,13 @@ func (p partition) String() string {
 	return fmt.Sprintf("chr:%s strand:(%v) class:%s", p.chrom, p.strand, p.class)
 }
 
-type part struct {
-	name        string
-	left, right int
-	genomic     location
-}
-
-// location is a repeat-matching interval.
-type location struct {
-	chrom  string
-	left   int
-	right  int
-	strand seq.Strand
-}
-
-type parts []part
-
-func (p parts) String() string {
-	var buf bytes.Buffer
-	for i, e := range p {
-		if i == 0 {
-			buf.WriteByte('"')
-		} else {
-			buf.WriteByte('|')
-		}
-		fmt.Fprintf(&buf, `%s %d %d %d %d`,
-			e.name,
-			feat.ZeroToOne(e.left), e.right,
-			feat.ZeroToOne(e.genomic.left), e.genomic.right,
-		)
-	}
-	buf.WriteByte('"')
-	return buf.String()
-}
-
-// simple is a masked repeat record.
-type simple struct {
-	// genomic is the genomic region matched
-	// to the the repeat identified below.
-	genomic location
-
-	// name and class that the repeat type
-	// and class defined by the masker.
-	name, class string
-
-	// score is the feature score.
-	score float64
-
-	// left and right are the left and right
-	// position of the simple alignment in
-	// consensus-relative coordinates.
-	left, right int
-}
-
-const none = -1
-
-func newSimpleRepeat(f *gff.Feature) (*simple, error) {
-	repeat := &simple{
-		genomic: location{
-			left:   f.FeatStart,
-			right:  f.FeatEnd,
-			chrom:  f.SeqName,
-			strand: f.FeatStrand,
-		},
-	}
-	if f.FeatScore != nil {
-		repeat.score = *f.FeatScore
-	}
-
-	ra := f.FeatAttributes.Get("Repeat")
-	if ra == "" {
-		return nil, fmt.Errorf("missing repeat tag: file probably not an RM gff.")
-	}
-	err := repeat.parse(ra)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse repeat tag: %v\n", err)
-	}
-	return repeat, nil
-}
-
-func (r *simple) parse(a string) error {
-	fields := strings.Split(a, " ")
-
-	r.name = fields[0]
-	r.class = fields[1]
-	var err error
-	if fields[2] != "." {
-		r.left, err = strconv.Atoi(fields[2])
-		if err != nil {
-			return err
-		}
-		r.left = feat.OneToZero(r.left)
-	} else {
-		r.left = none
-	}
-	if fields[3] != "." {
-		r.right, err = strconv.Atoi(fields[3])
-		if err != nil {
-			return err
-		}
-	} else {
-		r.right = none
-	}
-
-	return nil
-}
-
-type byRightEnd []*simple
-
-func (r byRightEnd) Len() int { return len(r) }
-func (r byRightEnd) Less(i, j int) bool {
-	iName := r[i].genomic.chrom
-	jName := r[j].genomic.chrom
-	return iName < jName || (iName == jName && r[i].genomic.right < r[j].genomic.right)
-}
-func (r byRightEnd) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
-
-type byGenomeLocation []composite
+type byGenomeLocation []chain.Composite
 
 func (c byGenomeLocation) Len() int { return len(c) }
 func (c byGenomeLocation) Less(i, j int) bool {
-	iName := c[i].parts[0].genomic.chrom
-	jName := c[j].parts[0].genomic.chrom
-	return iName < jName || (iName == jName && c[i].parts[0].genomic.left < c[j].parts[0].genomic.left)
+	iName := c[i].Parts[0].Genomic.Chrom
+	jName := c[j].Parts[0].Genomic.Chrom
+	return iName < jName || (iName == jName && c[i].Parts[0].Genomic.Left < c[j].Parts[0].Genomic.Left)
 }
 func (c byGenomeLocation) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
 
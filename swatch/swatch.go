@@ -0,0 +1,205 @@
+// Copyright ©2015 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// swatch extracts the sequences of stitch-chained composite repeats from a
+// genome.
+//
+// Composites are read from stitch or patchwork output and their sequences are
+// written as fasta. The -mode flag selects the sequence written for each
+// composite:
+//
+//	span:      the full genomic span of the composite
+//	spliced:   the concatenated parts of the composite with insertions
+//	           between the parts spliced out
+//	consensus: the spliced sequence, reverse complemented for composites
+//	           on the minus strand to match the consensus orientation
+//
+// Overlapping parts are merged before splicing. Each sequence is named by the
+// location and strand of the composite and is described by its class, the name
+// of its first part and its parts, for example:
+//
+//	>chr1:1001-7500(+) LTR/ERV1/MER41 parts="MER41 1 1000 1001 2000|MER41 1001 5000 3501 7500"
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/biogo/biogo/alphabet"
+	"github.com/biogo/biogo/feat"
+	"github.com/biogo/biogo/io/featio/gff"
+	"github.com/biogo/biogo/io/seqio"
+	"github.com/biogo/biogo/io/seqio/fasta"
+	"github.com/biogo/biogo/seq"
+	"github.com/biogo/biogo/seq/linear"
+
+	"github.com/kortschak/quilt/chain"
+)
+
+var (
+	inFile     = flag.String("in", "", "Filename for stitch or patchwork composites.")
+	genomeFile = flag.String("genome", "", "Filename for genome fasta.")
+	mode       = flag.String("mode", "span", "Sequence to extract: span, spliced or consensus.")
+	help       = flag.Bool("help", false, "Print this usage message.")
+)
+
+func main() {
+	flag.Parse()
+	if *help || *inFile == "" || *genomeFile == "" {
+		flag.Usage()
+		os.Exit(0)
+	}
+	switch *mode {
+	case "span", "spliced", "consensus":
+	default:
+		log.Fatalf("unknown extraction mode: %q", *mode)
+	}
+
+	f, err := os.Open(*inFile)
+	if err != nil {
+		log.Fatalf("could not open %q: %v", *inFile, err)
+	}
+	fmt.Fprintf(os.Stderr, "reading composite features from %q.\n", *inFile)
+	in := gff.NewReader(f)
+
+	composites := make(map[string][]composite)
+	for {
+		f, err := in.Read()
+		if err != nil {
+			if err != io.EOF {
+				log.Fatalf("failed to read source feature: %v", err)
+			}
+			break
+		}
+
+		gf := f.(*gff.Feature)
+		if gf.Source != "stitch" && gf.Source != "patch" {
+			continue
+		}
+		c, err := newComposite(gf)
+		if err != nil {
+			log.Fatal(err)
+		}
+		composites[gf.SeqName] = append(composites[gf.SeqName], c)
+	}
+	f.Close()
+
+	g, err := os.Open(*genomeFile)
+	if err != nil {
+		log.Fatalf("could not open %q: %v", *genomeFile, err)
+	}
+	defer g.Close()
+	fmt.Fprintf(os.Stderr, "reading genome from %q.\n", *genomeFile)
+
+	w := fasta.NewWriter(os.Stdout, 60)
+	sc := seqio.NewScanner(fasta.NewReader(g, linear.NewSeq("", nil, alphabet.DNA)))
+	for sc.Next() {
+		chrom := sc.Seq().(*linear.Seq)
+		cs, ok := composites[chrom.Name()]
+		if !ok {
+			continue
+		}
+		delete(composites, chrom.Name())
+		sort.Sort(byStart(cs))
+		for _, c := range cs {
+			if c.FeatEnd > chrom.Len() {
+				log.Fatalf("composite extends beyond end of %s: %v", chrom.Name(), c.Feature)
+			}
+			_, err := w.Write(c.sequence(chrom.Seq, *mode))
+			if err != nil {
+				log.Fatalf("failed to write sequence: %v", err)
+			}
+		}
+	}
+	if sc.Error() != nil {
+		log.Fatalf("failed during genome read: %v", sc.Error())
+	}
+	for chr, cs := range composites {
+		log.Printf("no sequence for %s: %d composites not extracted", chr, len(cs))
+	}
+}
+
+type composite struct {
+	*gff.Feature
+
+	class string
+	parts chain.Parts
+}
+
+func newComposite(f *gff.Feature) (composite, error) {
+	c := composite{Feature: f}
+
+	var err error
+	c.class, err = strconv.Unquote(f.FeatAttributes.Get("Class"))
+	if err != nil {
+		return c, fmt.Errorf("failed to unquote class: %v", err)
+	}
+	parts := f.FeatAttributes.Get("Parts")
+	if parts == "" {
+		return c, fmt.Errorf("missing parts tag: file not a valid stitch gff.")
+	}
+	c.parts, err = chain.ParseParts(parts, f.SeqName, f.FeatStrand)
+	if err != nil {
+		return c, fmt.Errorf("%v: %v", err, f)
+	}
+	return c, nil
+}
+
+// sequence returns the sequence of c extracted from chrom according to mode.
+func (c composite) sequence(chrom alphabet.Letters, mode string) *linear.Seq {
+	var s alphabet.Letters
+	switch mode {
+	case "span":
+		s = chrom[c.FeatStart:c.FeatEnd]
+	case "spliced", "consensus":
+		for _, p := range c.merged() {
+			s = append(s, chrom[p.Genomic.Left:p.Genomic.Right]...)
+		}
+	}
+
+	id := fmt.Sprintf("%s:%d-%d(%s)", c.SeqName, feat.ZeroToOne(c.FeatStart), c.FeatEnd, c.FeatStrand)
+	r := linear.NewSeq(id, s, alphabet.DNA)
+	r.Desc = fmt.Sprintf("%s/%s parts=%s", c.class, c.parts[0].Name, c.FeatAttributes.Get("Parts"))
+	if mode == "consensus" && c.FeatStrand == seq.Minus {
+		r.RevComp()
+	}
+	return r
+}
+
+// merged returns the parts of c sorted by position with overlapping
+// parts merged.
+func (c composite) merged() chain.Parts {
+	p := make(chain.Parts, len(c.parts))
+	copy(p, c.parts)
+	sort.Sort(byLeft(p))
+	m := p[:1]
+	for _, e := range p[1:] {
+		last := &m[len(m)-1]
+		if e.Genomic.Left <= last.Genomic.Right {
+			if e.Genomic.Right > last.Genomic.Right {
+				last.Genomic.Right = e.Genomic.Right
+			}
+			continue
+		}
+		m = append(m, e)
+	}
+	return m
+}
+
+type byStart []composite
+
+func (c byStart) Len() int           { return len(c) }
+func (c byStart) Less(i, j int) bool { return c[i].FeatStart < c[j].FeatStart }
+func (c byStart) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+
+type byLeft chain.Parts
+
+func (p byLeft) Len() int           { return len(p) }
+func (p byLeft) Less(i, j int) bool { return p[i].Genomic.Left < p[j].Genomic.Left }
+func (p byLeft) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
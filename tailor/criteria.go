@@ -0,0 +1,165 @@
+// Copyright ©2015 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/biogo/biogo/io/featio/gff"
+)
+
+// criteria specify when a feature is considered to be part of a composite.
+type criteria struct {
+	// span is the composite span criterion,
+	// either "contain" or "overlap".
+	span string
+
+	// minOverlap is the minimum number of bases
+	// a feature must overlap a part.
+	minOverlap int
+
+	// minFrac is the minimum fraction of the
+	// feature, and of the part if reciprocal
+	// is true, that must be overlapped.
+	minFrac    float64
+	reciprocal bool
+
+	// match is the repeat identity required of
+	// a feature and part, "none", "class" or
+	// "name".
+	match string
+}
+
+func (c criteria) validate() error {
+	switch c.span {
+	case "contain", "overlap":
+	default:
+		return fmt.Errorf("invalid span criterion: %q", c.span)
+	}
+	switch c.match {
+	case "none", "class", "name":
+	default:
+		return fmt.Errorf("invalid match criterion: %q", c.match)
+	}
+	if c.minFrac < 0 || c.minFrac > 1 {
+		return fmt.Errorf("invalid minimum overlap fraction: %v", c.minFrac)
+	}
+	return nil
+}
+
+// spans returns whether f satisfies the span criterion for in.
+func (c criteria) spans(f *gff.Feature, in composite) bool {
+	if c.span == "contain" {
+		return f.FeatStart >= in.FeatStart && f.FeatEnd <= in.FeatEnd
+	}
+	return f.FeatStart < in.FeatEnd && f.FeatEnd > in.FeatStart
+}
+
+// hits returns whether f, with the given repeat name and class, hits the
+// part p of in.
+func (c criteria) hits(f *gff.Feature, name, class string, in composite, p part) bool {
+	switch c.match {
+	case "class":
+		if class != in.class {
+			return false
+		}
+	case "name":
+		if name != p.name {
+			return false
+		}
+	}
+
+	overlap := min(f.FeatEnd, p.right) - max(f.FeatStart, p.left)
+	if overlap <= 0 || overlap < c.minOverlap {
+		return false
+	}
+	if float64(overlap) < c.minFrac*float64(f.Len()) {
+		return false
+	}
+	return !c.reciprocal || float64(overlap) >= c.minFrac*float64(p.right-p.left)
+}
+
+// repeatOf returns the repeat name and class of f.
+func repeatOf(f *gff.Feature) (name, class string) {
+	if fields := strings.Fields(f.FeatAttributes.Get("Repeat")); len(fields) >= 2 {
+		return fields[0], fields[1]
+	}
+	class, _ = strconv.Unquote(f.FeatAttributes.Get("Class"))
+	return "", class
+}
+
+// rules holds the default criteria and any per-class criteria.
+type rules struct {
+	def     criteria
+	byClass map[string]criteria
+}
+
+// forClass returns the criteria to use for composites of the given class.
+func (r rules) forClass(class string) criteria {
+	c, ok := r.byClass[class]
+	if !ok {
+		return r.def
+	}
+	return c
+}
+
+// readRules reads per-class criteria from the named file. Criteria not
+// specified for a class are taken from def.
+func readRules(file string, def criteria) (rules, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return rules{}, fmt.Errorf("failed to open class criteria %q: %v", file, err)
+	}
+	defer f.Close()
+
+	r := rules{def: def, byClass: make(map[string]criteria)}
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		c := def
+		for _, kv := range fields[1:] {
+			kv = strings.TrimSpace(kv)
+			if kv == "" {
+				continue
+			}
+			i := strings.Index(kv, "=")
+			if i < 0 {
+				return rules{}, fmt.Errorf("invalid criterion on line %d: %q", n, kv)
+			}
+			key, val := kv[:i], kv[i+1:]
+			switch key {
+			case "span":
+				c.span = val
+			case "match":
+				c.match = val
+			case "min-overlap":
+				c.minOverlap, err = strconv.Atoi(val)
+			case "min-overlap-frac":
+				c.minFrac, err = strconv.ParseFloat(val, 64)
+			case "reciprocal":
+				c.reciprocal, err = strconv.ParseBool(val)
+			default:
+				return rules{}, fmt.Errorf("unknown criterion on line %d: %q", n, key)
+			}
+			if err != nil {
+				return rules{}, fmt.Errorf("failed to parse %s on line %d: %v", key, n, err)
+			}
+		}
+		err = c.validate()
+		if err != nil {
+			return rules{}, fmt.Errorf("line %d: %v", n, err)
+		}
+		r.byClass[fields[0]] = c
+	}
+	return r, sc.Err()
+}
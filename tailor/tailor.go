@@ -4,25 +4,82 @@
 
 // tailor filters a set of repeat annotations for segments that have been
 // identified as part of a stitch-chained set of segments.
+//
+// By default, features that overlap any part of a composite are dropped. With
+// the -trim flag, features are instead clipped to the regions outside the
+// composite parts, with the consensus coordinates in the Repeat attribute
+// adjusted in proportion to the clipping. Clipped segments shorter than
+// -min-length bases or shorter than -min-frac of the original feature are
+// dropped.
+//
+// A feature hits a composite part when the feature satisfies the composite span
+// criterion given by -span, either being contained by or overlapping the span of
+// the composite, and overlaps the part by at least -min-overlap bases and at least
+// -min-overlap-frac of the feature's length. If -reciprocal is set, the overlap
+// must also be at least -min-overlap-frac of the part's length. The -match flag
+// optionally requires that the feature have the same repeat class or name as the
+// part.
+//
+// Criteria may be given for individual composite classes in a file specified by
+// -class-criteria. Each line of the file holds a class followed by tab-separated
+// key=value pairs using the names of the criteria flags, for example:
+//
+//	LINE/L1	span=overlap	min-overlap=20	min-overlap-frac=0.1	match=name
+//
+// Criteria not specified for a class take the values given by the flags. Blank
+// lines and lines starting with '#' are ignored.
+//
+// If -removed is given, each dropped feature is written to the named file with
+// a StitchedInto attribute giving the location and class of the composites it
+// was absorbed into, for example:
+//
+//	StitchedInto "chr1 1000 7200 LINE/L1"
+//
+// Multiple composites are separated by '|'. Features that are trimmed but not
+// dropped are not written to the removed features file.
+//
+// Composites are found using either an interval tree holding all composites or,
+// when the composite and feature files are all sorted by sequence name and start,
+// a streaming sweep line that holds only the composites near the current feature.
+// By default, the sweep line is used when all inputs are sorted.
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"os"
 	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/biogo/biogo/feat"
 	"github.com/biogo/biogo/io/featio/gff"
-	"github.com/biogo/store/interval"
+	"github.com/biogo/biogo/seq"
+
+	"github.com/kortschak/quilt/overlap"
 )
 
 var (
-	inFile = flag.String("in", "", "Filename for stitch TinT analysis.")
-	help   = flag.Bool("help", false, "Print this usage message.")
+	inFile    = flag.String("in", "", "Filename for stitch TinT analysis.")
+	trim      = flag.Bool("trim", false, "Trim features to the regions outside composite parts instead of dropping them.")
+	minLength = flag.Int("min-length", 1, "Minimum length of a trimmed feature to retain.")
+	minFrac   = flag.Float64("min-frac", 0, "Minimum fraction of the original feature length of a trimmed feature to retain.")
+
+	span        = flag.String("span", "", "Composite span criterion: contain or overlap (default contain, or overlap with -trim).")
+	minOverlap  = flag.Int("min-overlap", 1, "Minimum overlap in bases between a feature and a composite part.")
+	minOverFrac = flag.Float64("min-overlap-frac", 0, "Minimum overlap between a feature and a composite part as a fraction of the feature length.")
+	reciprocal  = flag.Bool("reciprocal", false, "Require the minimum overlap fraction to hold for the composite part as well as the feature.")
+	match       = flag.String("match", "none", "Repeat identity required between a feature and a composite part: none, class or name.")
+	classFile   = flag.String("class-criteria", "", "Filename for per-class overlap criteria.")
+
+	removed = flag.String("removed", "", "Filename to write removed features to.")
+	engine  = flag.String("engine", "auto", "Overlap engine: tree, sweep or auto to use sweep when all inputs are sorted.")
+
+	help = flag.Bool("help", false, "Print this usage message.")
 )
 
 func main() {
@@ -32,72 +89,75 @@ func main() {
 		os.Exit(0)
 	}
 
-	f, err := os.Open(*inFile)
+	if *span == "" {
+		if *trim {
+			*span = "overlap"
+		} else {
+			*span = "contain"
+		}
+	}
+	def := criteria{
+		span:       *span,
+		minOverlap: *minOverlap,
+		minFrac:    *minOverFrac,
+		reciprocal: *reciprocal,
+		match:      *match,
+	}
+	err := def.validate()
 	if err != nil {
-		log.Fatalf("could not open %q: %v", *inFile, err)
+		log.Fatal(err)
 	}
-	fmt.Fprintf(os.Stderr, "reading stitched repeat features from %q.\n", *inFile)
-	in := gff.NewReader(f)
-
-	trees := make(map[string]*interval.IntTree)
-	for {
-		f, err := in.Read()
+	r := rules{def: def}
+	if *classFile != "" {
+		r, err = readRules(*classFile, def)
 		if err != nil {
-			if err != io.EOF {
-				log.Fatalf("failed to read source feature: %v", err)
-			}
-			break
+			log.Fatal(err)
 		}
+	}
 
-		c := composite{Feature: f.(*gff.Feature)}
-		if c.Source != "stitch" {
-			continue
-		}
+	useSweep, err := overlap.UseSweep(*engine, append([]string{*inFile}, flag.Args()...)...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !useSweep && *engine == "auto" {
+		fmt.Fprintln(os.Stderr, "inputs are not sorted: using interval tree.")
+	}
 
-		parts := c.FeatAttributes.Get("Parts")
-		if parts == "" {
-			log.Fatal("missing parts tag: file not a valid stitch gff.")
-		}
-		parts, err = strconv.Unquote(parts)
+	var tree *overlap.Tree
+	if useSweep {
+		fmt.Fprintf(os.Stderr, "streaming stitched repeat features from %q.\n", *inFile)
+	} else {
+		tree, err = readTree(*inFile)
 		if err != nil {
-			log.Fatalf("failed to unquote parts: %v", err)
+			log.Fatal(err)
 		}
+	}
 
-		for _, p := range strings.Split(parts, "|") {
-			fields := strings.Fields(p)
-			if len(fields) != 5 {
-				log.Fatalf("unexpected number of fields in %q: %v", p, c.Feature)
-			}
-			left, err := strconv.Atoi(fields[3])
-			if err != nil {
-				log.Fatalf("failed to parse left coordinate: %v", fields[3])
-			}
-			right, err := strconv.Atoi(fields[3])
+	w := gff.NewWriter(os.Stdout, 60, true)
+	var rw *gff.Writer
+	if *removed != "" {
+		f, err := os.Create(*removed)
+		if err != nil {
+			log.Fatalf("could not create %q: %v", *removed, err)
+		}
+		defer f.Close()
+		rw = gff.NewWriter(f, 60, true)
+	}
+	for _, q := range flag.Args() {
+		var (
+			finder overlap.Finder = tree
+			sweep  *overlap.Sweep
+			cf     *os.File
+		)
+		if useSweep {
+			cf, err = os.Open(*inFile)
 			if err != nil {
-				log.Fatalf("failed to parse right coordinate: %v", fields[4])
+				log.Fatalf("could not open %q: %v", *inFile, err)
 			}
-			c.parts = append(c.parts, part{left: left, right: right})
+			sweep = overlap.NewSweep(composites(gff.NewReader(cf)))
+			finder = sweep
 		}
 
-		t, ok := trees[c.SeqName]
-		if !ok {
-			t = &interval.IntTree{}
-			trees[c.SeqName] = t
-		}
-		c.id = uintptr(t.Len())
-		t.Insert(c, true)
-	}
-	f.Close()
-
-	var chroms []string
-	for chr, t := range trees {
-		t.AdjustRanges()
-		chroms = append(chroms, chr)
-	}
-	sort.Strings(chroms)
-
-	w := gff.NewWriter(os.Stdout, 60, true)
-	for _, q := range flag.Args() {
 		f, err := os.Open(q)
 		if err != nil {
 			log.Fatalf("could not open %q: %v", q, err)
@@ -114,53 +174,270 @@ func main() {
 				break
 			}
 
-			if !hitsComposite(f.(*gff.Feature), trees) {
-				w.Write(f)
+			gf := f.(*gff.Feature)
+			h, err := hits(gf, finder, r)
+			if err != nil {
+				log.Fatalf("failed to find composites for %v: %v", gf, err)
+			}
+			var kept []*gff.Feature
+			switch {
+			case len(h) == 0:
+				kept = []*gff.Feature{gf}
+			case *trim:
+				kept = trimmed(gf, h, *minLength, *minFrac)
+			}
+			for _, k := range kept {
+				w.Write(k)
+			}
+			if len(kept) == 0 && rw != nil {
+				rw.Write(stitchedInto(gf, h))
 			}
 		}
 		f.Close()
+
+		if useSweep {
+			err = sweep.Close()
+			if err != nil {
+				log.Fatalf("failed to read composites: %v", err)
+			}
+			cf.Close()
+		}
+	}
+}
+
+// readTree returns an overlap.Tree holding the stitch composites in the
+// named file.
+func readTree(file string) (*overlap.Tree, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %q: %v", file, err)
+	}
+	defer f.Close()
+	fmt.Fprintf(os.Stderr, "reading stitched repeat features from %q.\n", file)
+
+	t := overlap.NewTree()
+	next := composites(gff.NewReader(f))
+	for {
+		c, err := next()
+		if err != nil {
+			if err != io.EOF {
+				return nil, err
+			}
+			return t, nil
+		}
+		t.Insert(c)
+	}
+}
+
+// composites returns a Stream of the stitch composites read by r.
+func composites(r *gff.Reader) overlap.Stream {
+	var id uintptr
+	return func() (feat.Feature, error) {
+		for {
+			f, err := r.Read()
+			if err != nil {
+				if err != io.EOF {
+					err = fmt.Errorf("failed to read source feature: %v", err)
+				}
+				return nil, err
+			}
+			gf := f.(*gff.Feature)
+			if gf.Source != "stitch" {
+				continue
+			}
+			c, err := newComposite(gf)
+			if err != nil {
+				return nil, err
+			}
+			c.id = id
+			id++
+			return c, nil
+		}
 	}
 }
 
-func hitsComposite(f *gff.Feature, trees map[string]*interval.IntTree) bool {
-	t, ok := trees[f.SeqName]
-	if !ok {
-		return false
+// newComposite returns a composite parsed from the stitch feature f.
+func newComposite(f *gff.Feature) (composite, error) {
+	c := composite{Feature: f}
+
+	var err error
+	c.class, err = strconv.Unquote(c.FeatAttributes.Get("Class"))
+	if err != nil {
+		return c, fmt.Errorf("failed to unquote class: %v", err)
+	}
+
+	parts := c.FeatAttributes.Get("Parts")
+	if parts == "" {
+		return c, fmt.Errorf("missing parts tag: file not a valid stitch gff.")
 	}
-	for _, m := range t.Get((*query)(f)) {
-		in := m.(composite)
+	parts, err = strconv.Unquote(parts)
+	if err != nil {
+		return c, fmt.Errorf("failed to unquote parts: %v", err)
+	}
+
+	for _, p := range strings.Split(parts, "|") {
+		fields := strings.Fields(p)
+		if len(fields) != 5 {
+			return c, fmt.Errorf("unexpected number of fields in %q: %v", p, c.Feature)
+		}
+		left, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return c, fmt.Errorf("failed to parse left coordinate: %v", fields[3])
+		}
+		right, err := strconv.Atoi(fields[4])
+		if err != nil {
+			return c, fmt.Errorf("failed to parse right coordinate: %v", fields[4])
+		}
+		c.parts = append(c.parts, part{name: fields[0], left: feat.OneToZero(left), right: right})
+	}
+	return c, nil
+}
+
+// hit is a composite part hit by a feature.
+type hit struct {
+	composite
+	part
+}
+
+// hits returns the composite parts found by finder that are hit by f
+// according to the criteria in r for the class of each composite.
+func hits(f *gff.Feature, finder overlap.Finder, r rules) ([]hit, error) {
+	name, class := repeatOf(f)
+	var h []hit
+	err := finder.Find(f, func(ref feat.Feature) {
+		in := ref.(composite)
+		c := r.forClass(in.class)
+		if !c.spans(f, in) {
+			return
+		}
 		for _, p := range in.parts {
-			if f.FeatStart < p.right && f.FeatEnd > p.left {
-				return true
+			if c.hits(f, name, class, in, p) {
+				h = append(h, hit{composite: in, part: p})
 			}
 		}
+	})
+	return h, err
+}
+
+// trimmed returns the segments of f that do not overlap any of the composite
+// parts in h. Segments shorter than minLength or shorter than minFrac of the
+// length of f are discarded.
+func trimmed(f *gff.Feature, h []hit, minLength int, minFrac float64) []*gff.Feature {
+	sort.Sort(byLeft(h))
+	var segs []*gff.Feature
+	keep := func(left, right int) {
+		n := right - left
+		if n <= 0 || n < minLength || float64(n) < minFrac*float64(f.Len()) {
+			return
+		}
+		segs = append(segs, clip(f, left, right))
 	}
-	return false
+	left := f.FeatStart
+	for _, p := range h {
+		keep(left, p.left)
+		if p.right > left {
+			left = p.right
+		}
+	}
+	keep(left, f.FeatEnd)
+	return segs
+}
+
+// stitchedInto returns a copy of f with a StitchedInto attribute listing
+// the location and class of each distinct composite in h.
+func stitchedInto(f *gff.Feature, h []hit) *gff.Feature {
+	var (
+		buf  bytes.Buffer
+		seen = make(map[uintptr]bool)
+	)
+	for _, e := range h {
+		if seen[e.id] {
+			continue
+		}
+		if len(seen) == 0 {
+			buf.WriteByte('"')
+		} else {
+			buf.WriteByte('|')
+		}
+		seen[e.id] = true
+		fmt.Fprintf(&buf, "%s %d %d %s", e.SeqName, feat.ZeroToOne(e.FeatStart), e.FeatEnd, e.class)
+	}
+	buf.WriteByte('"')
+
+	c := *f
+	c.FeatAttributes = make(gff.Attributes, len(f.FeatAttributes), len(f.FeatAttributes)+1)
+	copy(c.FeatAttributes, f.FeatAttributes)
+	c.FeatAttributes = append(c.FeatAttributes, gff.Attribute{Tag: "StitchedInto", Value: buf.String()})
+	return &c
+}
+
+// clip returns a copy of f clipped to [left, right). The consensus
+// coordinates of the Repeat attribute of the copy are adjusted in
+// proportion to the clipped genomic coordinates.
+func clip(f *gff.Feature, left, right int) *gff.Feature {
+	c := *f
+	c.FeatStart = left
+	c.FeatEnd = right
+	c.FeatAttributes = make(gff.Attributes, len(f.FeatAttributes))
+	copy(c.FeatAttributes, f.FeatAttributes)
+	for i, a := range c.FeatAttributes {
+		if a.Tag == "Repeat" {
+			c.FeatAttributes[i].Value = clipRepeat(a.Value, f, left, right)
+		}
+	}
+	return &c
+}
+
+// clipRepeat returns the Repeat attribute value a of f adjusted for
+// clipping f to [left, right). Repeat attributes without consensus
+// coordinates are returned unaltered.
+func clipRepeat(a string, f *gff.Feature, left, right int) string {
+	fields := strings.Fields(a)
+	if len(fields) != 5 {
+		return a
+	}
+	cLeft, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return a
+	}
+	cRight, err := strconv.Atoi(fields[3])
+	if err != nil {
+		return a
+	}
+	remains, err := strconv.Atoi(fields[4])
+	if err != nil {
+		return a
+	}
+
+	n := float64(cRight - cLeft + 1)
+	from := float64(left-f.FeatStart) / float64(f.Len())
+	to := float64(right-f.FeatStart) / float64(f.Len())
+	if f.FeatStrand == seq.Minus {
+		from, to = 1-to, 1-from
+	}
+	newLeft := cLeft + int(math.Floor(from*n+0.5))
+	newRight := cLeft - 1 + int(math.Floor(to*n+0.5))
+	if newRight < newLeft {
+		newRight = newLeft
+	}
+	return fmt.Sprintf("%s %s %d %d %d", fields[0], fields[1], newLeft, newRight, remains+cRight-newRight)
 }
 
 type composite struct {
 	*gff.Feature
 	id uintptr
 
+	class string
 	parts []part
 }
 
 type part struct {
+	name        string
 	left, right int
 }
 
-// Overlap returns whether q overlaps b.
-func (c composite) Overlap(b interval.IntRange) bool {
-	return c.FeatEnd > b.Start && c.FeatStart < b.End
-}
-func (c composite) ID() uintptr              { return c.id }
-func (c composite) Range() interval.IntRange { return interval.IntRange{c.FeatStart, c.FeatEnd} }
-
-type query gff.Feature
+type byLeft []hit
 
-// Overlap returns whether q is entirely within b.
-func (q *query) Overlap(b interval.IntRange) bool {
-	return q.FeatStart >= b.Start && q.FeatEnd <= b.End
-}
-func (q *query) ID() uintptr              { return 0 }
-func (q *query) Range() interval.IntRange { return interval.IntRange{q.FeatStart, q.FeatEnd} }
+func (h byLeft) Len() int           { return len(h) }
+func (h byLeft) Less(i, j int) bool { return h[i].left < h[j].left }
+func (h byLeft) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }